@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+)
+
+// the groups Kubernetes assigns to subjects implicitly
+const (
+	groupAuthenticated   = "system:authenticated"
+	groupServiceAccounts = "system:serviceaccounts" // and system:serviceaccounts:NAMESPACE
+)
+
+// Grant is a (Cluster)Role granted to a subject through a (Cluster)RoleBinding
+type Grant struct {
+	binding Binding
+	role    Role
+}
+
+// scope returns the namespace the grant applies to ("" if it applies cluster-wide)
+func (g Grant) scope() string {
+	return g.binding.namespace
+}
+
+// grantsFor returns all grants whose bindings reference the given subject directly
+func (r *Rback) grantsFor(subject KindNamespacedName) []Grant {
+	grants := []Grant{}
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			if !binding.hasSubject(subject) {
+				continue
+			}
+			if role, found := r.permissions.Roles[binding.role.namespace][binding.role.name]; found {
+				grants = append(grants, Grant{binding, role})
+			}
+		}
+	}
+	return grants
+}
+
+// effectiveGrantsFor returns the grants of the subject and of the groups it's a member of: the given groups and the
+// groups Kubernetes assigns implicitly; bindings referencing several of them are only returned once
+func (r *Rback) effectiveGrantsFor(subject KindNamespacedName, groups []string) []Grant {
+	grants := []Grant{}
+	seen := map[NamespacedName]bool{}
+	add := func(subject KindNamespacedName) {
+		for _, grant := range r.grantsFor(subject) {
+			if !seen[grant.binding.NamespacedName] {
+				seen[grant.binding.NamespacedName] = true
+				grants = append(grants, grant)
+			}
+		}
+	}
+	add(subject)
+	for _, group := range append(append([]string{}, groups...), implicitGroups(subject)...) {
+		add(KindNamespacedName{"Group", NamespacedName{"", group}})
+	}
+	return grants
+}
+
+// implicitGroups returns the groups Kubernetes assigns to the subject implicitly: system:authenticated (to all but
+// groups), and system:serviceaccounts and system:serviceaccounts:NAMESPACE to ServiceAccounts
+func implicitGroups(subject KindNamespacedName) []string {
+	groups := []string{}
+	if subject.kind != "Group" {
+		groups = append(groups, groupAuthenticated)
+	}
+	if subject.kind == "ServiceAccount" {
+		groups = append(groups, groupServiceAccounts, groupServiceAccounts+":"+subject.namespace)
+	}
+	return groups
+}
+
+func (b Binding) hasSubject(subject KindNamespacedName) bool {
+	for _, s := range b.subjects {
+		if s.kind == subject.kind && s.name == subject.name && (s.kind != "ServiceAccount" || s.namespace == subject.namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns true if the rule allows the verb on the given resource ("resource" or "resource/subresource")
+func (rule Rule) allows(verb, apiGroup, resource, name string) bool {
+	return matchesValueOrWildcard(rule.verbs, verb) &&
+		matchesValueOrWildcard(rule.apiGroups, apiGroup) &&
+		rule.allowsResource(resource) &&
+		(len(rule.resourceNames) == 0 || contains(rule.resourceNames, name))
+}
+
+// allowsResource matches the resource like the API server's RBAC authorizer: only "*", the resource itself and
+// "*/SUBRESOURCE" (e.g. "*/scale" allows "deployments/scale") match, but e.g. "pods/*" doesn't allow "pods/log"
+func (rule Rule) allowsResource(resource string) bool {
+	subresource := ""
+	if i := strings.Index(resource, "/"); i >= 0 {
+		subresource = resource[i+1:]
+	}
+	for _, r := range rule.resources {
+		if r == "*" || r == resource {
+			return true
+		}
+		if subresource != "" && strings.HasPrefix(r, "*/") && r[2:] == subresource {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsNonResourceURL returns true if the rule allows the verb on the given non-resource URL (e.g. "/healthz")
+func (rule Rule) allowsNonResourceURL(verb, url string) bool {
+	return matchesValueOrWildcard(rule.verbs, verb) && rule.matchesNonResourceURL(url)
+}
+
+// matchesNonResourceURL returns true if the given non-resource URL is one of the rule's URLs or matches a URL ending
+// with "*", regardless of the verbs
+func (rule Rule) matchesNonResourceURL(url string) bool {
+	for _, u := range rule.nonResourceURLs {
+		if u == url || (strings.HasSuffix(u, "*") && strings.HasPrefix(url, strings.TrimSuffix(u, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesValueOrWildcard(values []string, value string) bool {
+	return contains(values, "*") || contains(values, value)
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	commandGraph      = "graph"
+	commandWhoCan     = "who-can"
+	commandUnused     = "unused"
+	commandSuggest    = "suggest"
+	commandCheck      = "check"
+	commandServe      = "serve"
+	commandReview     = "review"
+	commandMetrics    = "metrics"
+	commandReport     = "report"
+	commandCompletion = "completion"
+	commandHelp       = "help"
+)
+
+// command describes a subcommand of rback
+type command struct {
+	name        string
+	args        string // the positional arguments, as shown in the usage
+	description string
+	graph       bool                                   // whether the command renders a graph (and thus accepts the graph flags)
+	unfiltered  bool                                   // whether the command evaluates all RBAC resources, regardless of --ignore-prefixes
+	addFlags    func(fs *flag.FlagSet, config *Config) // adds the command-specific flags, if any
+	parseArgs   func(config *Config, args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{
+			name:        commandGraph,
+			args:        "[KIND [NAME...]]",
+			description: "Render all RBAC resources, or focus on the resources of the given kind and names (the default command)",
+			graph:       true,
+			parseArgs:   parseGraphArgs,
+		},
+		{
+			name:        commandWhoCan,
+			args:        "VERB RESOURCE[.GROUP][/SUBRESOURCE]|URL [NAME]",
+			description: "Render the subjects that can perform the verb on the resource",
+			graph:       true,
+			parseArgs:   parseWhoCanArgs,
+		},
+		{
+			name:        commandUnused,
+			description: "List ServiceAccounts and (Cluster)Roles that aren't used, and bindings without subjects",
+			unfiltered:  true,
+			parseArgs:   noArgs,
+		},
+		{
+			name:        commandSuggest,
+			description: "Suggest least-privilege roles based on an audit log",
+			unfiltered:  true,
+			addFlags: func(fs *flag.FlagSet, config *Config) {
+				fs.StringVar(&config.auditLogFile, "audit-log", config.auditLogFile, "The Kubernetes audit log (JSON lines) to derive the least-privilege roles from (required)")
+			},
+			parseArgs: func(config *Config, args []string) error {
+				if config.auditLogFile == "" {
+					return fmt.Errorf("--audit-log is required")
+				}
+				return noArgs(config, args)
+			},
+		},
+		{
+			name:        commandCheck,
+			description: "Check RBAC invariants defined in a policy file",
+			unfiltered:  true,
+			addFlags: func(fs *flag.FlagSet, config *Config) {
+				fs.StringVar(&config.policyFile, "policy", config.policyFile, "The policy file (YAML) containing the assertions to check (required)")
+			},
+			parseArgs: func(config *Config, args []string) error {
+				if config.policyFile == "" {
+					return fmt.Errorf("--policy is required")
+				}
+				return noArgs(config, args)
+			},
+		},
+		{
+			name:        commandMetrics,
+			description: "Print metrics about the RBAC posture in the Prometheus text exposition format",
+			unfiltered:  true,
+			parseArgs:   noArgs,
+		},
+		{
+			name:        commandReport,
+			description: "Generate an access review report per namespace in Markdown or HTML",
+			unfiltered:  true,
+			addFlags: func(fs *flag.FlagSet, config *Config) {
+				fs.StringVar(&config.reportFormat, "format", config.reportFormat, "The format of the report: md or html")
+			},
+			parseArgs: func(config *Config, args []string) error {
+				if config.reportFormat != reportMarkdown && config.reportFormat != reportHTML {
+					return fmt.Errorf("Invalid report format %q (supported: %s, %s)", config.reportFormat, reportMarkdown, reportHTML)
+				}
+				return noArgs(config, args)
+			},
+		},
+		{
+			name:        commandReview,
+			args:        "FILE...",
+			description: "Decide the SubjectAccessReviews in the files (JSON or YAML) like the API server's RBAC authorizer",
+			unfiltered:  true,
+			parseArgs: func(config *Config, args []string) error {
+				if len(args) == 0 {
+					return fmt.Errorf("Expected at least one file with SubjectAccessReviews")
+				}
+				config.reviewFiles = args
+				return nil
+			},
+		},
+		{
+			name:        commandServe,
+			description: "Serve a REST API and a web UI to query the RBAC resources of a snapshot",
+			graph:       true,
+			addFlags: func(fs *flag.FlagSet, config *Config) {
+				fs.StringVar(&config.snapshotFile, "snapshot", config.snapshotFile, "The snapshot of RBAC resources to serve, in any format accepted by -f (required)")
+				fs.StringVar(&config.listenAddress, "listen", config.listenAddress, "The address to listen on")
+			},
+			parseArgs: func(config *Config, args []string) error {
+				if config.snapshotFile == "" {
+					return fmt.Errorf("--snapshot is required")
+				}
+				if config.watch {
+					return fmt.Errorf("--watch isn't supported by serve")
+				}
+				config.inputFile = config.snapshotFile
+				return noArgs(config, args)
+			},
+		},
+		{
+			name:        commandCompletion,
+			args:        "bash|zsh|fish",
+			description: "Print the shell completion script for the given shell",
+			parseArgs: func(config *Config, args []string) error {
+				if len(args) != 1 || !contains(completionShells, args[0]) {
+					return fmt.Errorf("Expected one of %s", strings.Join(completionShells, ", "))
+				}
+				config.completionShell = args[0]
+				return nil
+			},
+		},
+		{
+			name:        commandHelp,
+			args:        "[COMMAND]",
+			description: "Show the help of rback or of the given command",
+			parseArgs: func(config *Config, args []string) error {
+				if len(args) == 0 {
+					printUsage(os.Stdout)
+					os.Exit(0)
+				}
+				cmd, found := findCommand(args[0])
+				if !found {
+					return fmt.Errorf("Unknown command %q", args[0])
+				}
+				printCommandUsage(os.Stdout, cmd)
+				os.Exit(0)
+				return nil
+			},
+		},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// flagValues holds the raw values of flags that are parsed or validated once all flags were read
+type flagValues struct {
+	namespaces        string
+	namespaceSelector string
+	selector          string
+	nameRegex         string
+	urlTemplate       string
+	themeName         string
+	ignoredPrefixes   string
+	profile           string
+}
+
+func defaultConfig() (Config, flagValues) {
+	config := Config{
+		showLegend:    true,
+		showRules:     true,
+		showWorkloads: true,
+		depth:         1,
+		treeRoot:      treeRootSubject,
+		color:         colorAuto,
+		reportFormat:  reportMarkdown,
+		listenAddress: ":8080",
+	}
+	values := flagValues{
+		themeName:       "default",
+		ignoredPrefixes: "system:",
+	}
+	return config, values
+}
+
+// The flags are registered with their current values as defaults, so that flags given before the command
+// aren't reset when the command's flags are registered.
+
+// addCommonFlags adds the flags accepted by all commands (except completion and help)
+func addCommonFlags(fs *flag.FlagSet, config *Config, values *flagValues) {
+	fs.StringVar(&config.inputFile, "f", config.inputFile, "The name of the file to use as input: a JSON List, or YAML or JSON manifests in a file or directory (otherwise stdin is used)")
+	fs.StringVar(&config.outputFile, "output-file", config.outputFile, "The name of the file to write the output to (otherwise stdout is used)")
+	fs.BoolVar(&config.watch, "watch", config.watch, "Watch the input (-f) and write the output (-output-file) again whenever it changes, printing a summary of the changes")
+	fs.StringVar(&config.outputFormat, "output", config.outputFormat, "The output format (for graph and who-can: dot, tree, plantuml, graphml, gexf, cypher or cypher-csv, which writes nodes.csv and relationships.csv to the directory -output-file; for unused and check: text or json; for review: text, json or yaml)")
+	fs.StringVar(&config.outputFormat, "o", config.outputFormat, "Shorthand for -output")
+	fs.StringVar(&values.namespaces, "n", values.namespaces, "The namespace to render (also supports multiple, comma-delimited namespaces, globs like 'team-*' and negation like '!kube-*')")
+	fs.StringVar(&values.namespaceSelector, "namespace-selector", values.namespaceSelector, "Only render namespaces whose labels match this label selector (requires Namespace objects in the input)")
+	fs.StringVar(&values.selector, "selector", values.selector, "Only render (Cluster)Roles, (Cluster)RoleBindings and ServiceAccounts whose labels match this label selector")
+	fs.StringVar(&values.selector, "l", values.selector, "Shorthand for -selector")
+	fs.StringVar(&values.ignoredPrefixes, "ignore-prefixes", values.ignoredPrefixes, "Comma-delimited list of (Cluster)Role(Binding) prefixes to ignore ('none' to not ignore anything; check, metrics, report, review, suggest and unused always take all resources into account)")
+	fs.StringVar(&values.profile, "profile", values.profile, "The profile of the configuration files (~/.config/rback/config.yaml and .rback.yaml) to use as defaults (also $RBACK_PROFILE)")
+}
+
+// addGraphFlags adds the flags accepted by the commands that render graphs
+func addGraphFlags(fs *flag.FlagSet, config *Config, values *flagValues) {
+	fs.BoolVar(&config.showLegend, "show-legend", config.showLegend, "Whether to show the legend or not")
+	fs.BoolVar(&config.showRules, "show-rules", config.showRules, "Whether to render RBAC access rules (e.g. \"get pods\") or not")
+	fs.BoolVar(&config.showWorkloads, "show-workloads", config.showWorkloads, "Whether to render workloads (Pods, Deployments, ...) linked to the ServiceAccounts they run as")
+	fs.BoolVar(&config.showSecrets, "show-secrets", config.showSecrets, "Whether to render the Secrets and image pull Secrets referenced by ServiceAccounts (and legacy token Secrets, if Secrets are part of the input)")
+	fs.BoolVar(&config.rawRules, "raw-rules", config.rawRules, "Render access rules line by line as written in the roles, instead of normalized (merged, deduplicated and grouped by API group)")
+	fs.BoolVar(&config.whoCan.showMatchedOnly, "show-matched-rules-only", config.whoCan.showMatchedOnly, "When running who-can, only show the matched rule instead of all rules specified in the role")
+	fs.IntVar(&config.depth, "depth", config.depth, "When focusing on a resource, also show the bindings up to N-1 steps away (sharing a subject or role) and all their subjects")
+	fs.BoolVar(&config.summary, "summary", config.summary, "Collapse every namespace that doesn't contain the focused resource into a single node")
+	fs.IntVar(&config.collapseSubjects, "collapse-subjects", config.collapseSubjects, "Collapse the subjects of a binding into a single node per kind if there are more than N of them (0 to never collapse)")
+	fs.IntVar(&config.maxNodes, "max-nodes", config.maxNodes, "Progressively collapse the graph until it has at most N nodes (0 for no limit)")
+	fs.StringVar(&values.nameRegex, "name-regex", values.nameRegex, "Only render resources of the focused kind whose names match this regular expression")
+	fs.StringVar(&values.urlTemplate, "url-template", values.urlTemplate, "Link nodes to this URL (Go template with .Kind, .Resource, .Namespace and .Name, e.g. 'https://console.example.com/ns/{{.Namespace}}/{{.Resource}}/{{.Name}}')")
+	fs.StringVar(&values.themeName, "theme", values.themeName, "The theme used to render graphs: a built-in theme (default, dark or colorblind) or a theme file (YAML)")
+	fs.StringVar(&config.treeRoot, "tree-root", config.treeRoot, "The roots of the tree output (-output tree): subject (subject, binding, role, rules) or role (role, rules, binding, subject)")
+	fs.StringVar(&config.color, "color", config.color, "Whether to color the tree output: auto (if writing to a terminal and $NO_COLOR isn't set), always or never")
+}
+
+// newCommandFlagSet returns the flag set with all flags accepted by the command
+func newCommandFlagSet(cmd command, config *Config, values *flagValues) *flag.FlagSet {
+	fs := flag.NewFlagSet("rback "+cmd.name, flag.ExitOnError)
+	if cmd.name != commandCompletion && cmd.name != commandHelp {
+		addCommonFlags(fs, config, values)
+	}
+	if cmd.graph {
+		addGraphFlags(fs, config, values)
+	}
+	if cmd.addFlags != nil {
+		cmd.addFlags(fs, config)
+	}
+	fs.Usage = func() {
+		printCommandUsage(os.Stderr, cmd)
+	}
+	return fs
+}
+
+func parseConfigFromArgs() Config {
+	config, values := defaultConfig()
+
+	// the configuration files provide the defaults of the flags
+	values.profile = profileFromArgs(os.Args[1:])
+	if err := applyConfigFiles(&config, &values, values.profile); err != nil {
+		fmt.Println(err)
+		os.Exit(-4)
+	}
+
+	// for backwards compatibility, all flags (except command-specific ones) can be given before the command
+	addCommonFlags(flag.CommandLine, &config, &values)
+	addGraphFlags(flag.CommandLine, &config, &values)
+	flag.Usage = func() {
+		printUsage(os.Stderr)
+	}
+	flag.Parse()
+
+	// without a known command, the arguments are the KIND and NAMEs of the graph command
+	cmd, _ := findCommand(commandGraph)
+	args := flag.Args()
+	if len(args) > 0 {
+		if c, found := findCommand(args[0]); found {
+			cmd, args = c, args[1:]
+		}
+	}
+	config.command = cmd.name
+
+	fs := newCommandFlagSet(cmd, &config, &values)
+	if err := cmd.parseArgs(&config, parseInterspersed(fs, args)); err != nil {
+		fmt.Println(err)
+		fmt.Println()
+		printCommandUsage(os.Stdout, cmd)
+		os.Exit(-4)
+	}
+
+	if config.watch && (config.inputFile == "" || config.outputFile == "") {
+		fmt.Println("Watching requires an input file or directory (-f) and an output file (-output-file)")
+		os.Exit(-4)
+	}
+	if config.watch && config.outputFormat == outputCypherCSV {
+		fmt.Printf("Watching doesn't support -output %s\n", outputCypherCSV)
+		os.Exit(-4)
+	}
+
+	if err := finishConfig(&config, values); err != nil {
+		fmt.Println(err)
+		os.Exit(-4)
+	}
+	return config
+}
+
+// finishConfig parses and validates the flag values that are stored in the config in a parsed form
+func finishConfig(config *Config, values flagValues) error {
+	config.flagValues = values
+	config.namespaces = strings.Split(values.namespaces, ",")
+
+	var err error
+	config.namespaceSelector, err = parseLabelSelector(values.namespaceSelector)
+	if err != nil {
+		return err
+	}
+	config.selector, err = parseLabelSelector(values.selector)
+	if err != nil {
+		return err
+	}
+	config.nameRegex = nil
+	if values.nameRegex != "" {
+		config.nameRegex, err = regexp.Compile(values.nameRegex)
+		if err != nil {
+			return fmt.Errorf("Invalid name regex %q: %v", values.nameRegex, err)
+		}
+	}
+
+	config.urlTemplate, err = parseURLTemplate(values.urlTemplate)
+	if err != nil {
+		return fmt.Errorf("Invalid URL template %q: %v", values.urlTemplate, err)
+	}
+	config.theme, err = loadTheme(values.themeName)
+	if err != nil {
+		return err
+	}
+	if config.treeRoot != treeRootSubject && config.treeRoot != treeRootRole {
+		return fmt.Errorf("Invalid tree root %q (supported: %s, %s)", config.treeRoot, treeRootSubject, treeRootRole)
+	}
+	if config.color != colorAuto && config.color != colorAlways && config.color != colorNever {
+		return fmt.Errorf("Invalid color mode %q (supported: %s, %s, %s)", config.color, colorAuto, colorAlways, colorNever)
+	}
+
+	config.ignoredPrefixes = nil
+	if cmd, _ := findCommand(config.command); values.ignoredPrefixes != "none" && !cmd.unfiltered {
+		config.ignoredPrefixes = strings.Split(values.ignoredPrefixes, ",")
+	}
+	return nil
+}
+
+// parseInterspersed parses the flags, which may be given before, between or after the positional arguments
+// (unless separated by "--"), and returns the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	positional := []string{}
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func parseGraphArgs(config *Config, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	kind := normalizeKind(args[0])
+	if !isKnownKind(kind) {
+		return fmt.Errorf("Unknown kind %q (supported: %s)", args[0], strings.Join(kindNames(), ", "))
+	}
+	config.resourceKind = kind
+	config.resourceNames = args[1:]
+	return nil
+}
+
+func parseWhoCanArgs(config *Config, args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return fmt.Errorf("Expected VERB RESOURCE [NAME]")
+	}
+	config.resourceKind = kindRule
+	config.whoCan.verb = args[0]
+	config.whoCan.resourceKind, config.whoCan.apiGroup = splitAPIGroup(args[1])
+	if len(args) > 2 {
+		config.whoCan.resourceName = args[2]
+	}
+	return nil
+}
+
+// splitAPIGroup splits a resource like "deployments.apps" or "deployments.apps/scale" into the resource
+// ("deployments" or "deployments/scale") and its API group, which is nil if not given
+func splitAPIGroup(resource string) (string, *string) {
+	subresource := ""
+	if i := strings.Index(resource, "/"); i > 0 {
+		resource, subresource = resource[:i], resource[i:]
+	}
+	if i := strings.Index(resource, "."); i > 0 {
+		apiGroup := resource[i+1:]
+		return resource[:i] + subresource, &apiGroup
+	}
+	return resource + subresource, nil
+}
+
+func noArgs(config *Config, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("Unexpected arguments: %s", strings.Join(args, " "))
+	}
+	return nil
+}
+
+// isKnownKind returns true if the (normalized) kind can be focused on
+func isKnownKind(kind string) bool {
+	for _, k := range kindMap {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// kindNames returns all kinds with their aliases, e.g. "serviceaccount (sa, serviceaccounts)"
+func kindNames() []string {
+	aliases := map[string][]string{}
+	for alias, kind := range kindMap {
+		aliases[kind] = append(aliases[kind], alias)
+	}
+	names := []string{}
+	for kind, a := range aliases {
+		sort.Strings(a)
+		names = append(names, fmt.Sprintf("%s (%s)", kind, strings.Join(a, ", ")))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "rback renders Kubernetes RBAC resources (read as a JSON List from stdin or -f) and analyzes them.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage: rback [FLAGS] [COMMAND] [FLAGS] [ARGS]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'rback help COMMAND' for the arguments and flags of a command.")
+}
+
+// printCommandUsage prints the usage of the command, including all its flags with their default values
+func printCommandUsage(w io.Writer, cmd command) {
+	config, values := defaultConfig()
+	fs := newCommandFlagSet(cmd, &config, &values)
+	fmt.Fprintf(w, "Usage: %s\n\n%s\n", strings.TrimSpace("rback "+cmd.name+" [FLAGS] "+cmd.args), cmd.description)
+	if cmd.name == commandGraph {
+		fmt.Fprintf(w, "\nKinds:\n  %s\n", strings.Join(kindNames(), "\n  "))
+	}
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// fileFlags are the flags whose values are completed with file names
+var fileFlags = []string{"f", "output-file", "snapshot", "audit-log", "policy", "theme"}
+
+// completionFlag describes a flag for the completion scripts
+type completionFlag struct {
+	name     string
+	usage    string
+	hasValue bool // false for boolean flags
+}
+
+// commandFlags returns the flags accepted by the command, sorted by name
+func commandFlags(cmd command) []completionFlag {
+	config, values := defaultConfig()
+	flags := []completionFlag{}
+	newCommandFlagSet(cmd, &config, &values).VisitAll(func(f *flag.Flag) {
+		boolFlag, isBool := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{f.Name, f.Usage, !isBool || !boolFlag.IsBoolFlag()})
+	})
+	return flags
+}
+
+// completionWords returns the words that can be completed as the first argument of the command
+func completionWords(cmd string) []string {
+	switch cmd {
+	case commandGraph:
+		return kindAliases()
+	case commandCompletion:
+		return completionShells
+	case commandHelp:
+		return commandNames()
+	}
+	return nil
+}
+
+func commandNames() []string {
+	names := []string{}
+	for _, cmd := range commands() {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+// kindAliases returns all names that can be used for kinds
+func kindAliases() []string {
+	aliases := map[string]bool{}
+	for alias, kind := range kindMap {
+		aliases[alias] = true
+		aliases[kind] = true
+	}
+	result := setToSlice(aliases)
+	sort.Strings(result)
+	return result
+}
+
+// valueFlagPatterns returns a shell case pattern matching all flags that take a value (with one or two dashes),
+// either including or excluding the flags that take file names
+func valueFlagPatterns(files bool) string {
+	names := map[string]bool{}
+	for _, cmd := range commands() {
+		for _, f := range commandFlags(cmd) {
+			if f.hasValue && contains(fileFlags, f.name) == files && f.name != "theme" {
+				names[f.name] = true
+			}
+		}
+	}
+	patterns := []string{}
+	for _, name := range sortedKeys(names) {
+		patterns = append(patterns, "-"+name, "--"+name)
+	}
+	return strings.Join(patterns, "|")
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := setToSlice(set)
+	sort.Strings(keys)
+	return keys
+}
+
+func printCompletion(w io.Writer, shell string) {
+	switch shell {
+	case "bash":
+		printBashCompletion(w)
+	case "zsh":
+		printZshCompletion(w)
+	case "fish":
+		printFishCompletion(w)
+	}
+}
+
+func printBashCompletion(w io.Writer) {
+	fmt.Fprintf(w, `# bash completion for rback, generated by 'rback completion bash'
+_rback() {
+    local cur prev cmd="" nargs=0 i words=""
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            %[1]s|%[2]s|-theme|--theme) i=$((i + 1)) ;;
+            -*) ;;
+            *)
+                if [[ -z "$cmd" ]]; then
+                    case "${COMP_WORDS[i]}" in
+                        %[3]s) cmd="${COMP_WORDS[i]}" ;;
+                        *) cmd=%[4]s; nargs=1 ;;
+                    esac
+                else
+                    nargs=$((nargs + 1))
+                fi
+                ;;
+        esac
+    done
+
+    case "$prev" in
+        %[1]s) COMPREPLY=($(compgen -f -- "$cur")); return ;;
+        -theme|--theme) COMPREPLY=($(compgen -W "%[5]s" -f -- "$cur")); return ;;
+        %[2]s) return ;;
+    esac
+
+    if [[ "$cur" == -* ]]; then
+        case "$cmd" in
+`, valueFlagPatterns(true), valueFlagPatterns(false), strings.Join(commandNames(), "|"), commandGraph, strings.Join(builtinThemeNames(), " "))
+	for _, cmd := range commands() {
+		pattern := cmd.name
+		if cmd.name == commandGraph {
+			pattern += `|""`
+		}
+		flags := []string{}
+		for _, f := range commandFlags(cmd) {
+			flags = append(flags, "--"+f.name)
+		}
+		fmt.Fprintf(w, "            %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", pattern, strings.Join(flags, " "))
+	}
+	fmt.Fprintf(w, `        esac
+        return
+    fi
+
+    case "$cmd" in
+        "") COMPREPLY=($(compgen -W "%s %s" -- "$cur")) ;;
+`, strings.Join(commandNames(), " "), strings.Join(kindAliases(), " "))
+	for _, cmd := range commands() {
+		if words := completionWords(cmd.name); words != nil {
+			fmt.Fprintf(w, "        %s) [[ $nargs -eq 0 ]] && COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", cmd.name, strings.Join(words, " "))
+		}
+	}
+	fmt.Fprint(w, `    esac
+}
+complete -F _rback rback
+`)
+}
+
+func printZshCompletion(w io.Writer) {
+	fmt.Fprint(w, `#compdef rback
+# zsh completion for rback, generated by 'rback completion zsh'
+_rback() {
+  local -a commands flags
+  commands=(
+`)
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "    %s\n", zshQuote(cmd.name+":"+cmd.description))
+	}
+	fmt.Fprintf(w, `  )
+  local cmd="" i nargs=0
+  for ((i = 2; i < CURRENT; i++)); do
+    case "${words[i]}" in
+      %[1]s|%[2]s|-theme|--theme) ((i++)) ;;
+      -*) ;;
+      *)
+        if [[ -z "$cmd" ]]; then
+          case "${words[i]}" in
+            %[3]s) cmd="${words[i]}" ;;
+            *) cmd=%[4]s; nargs=1 ;;
+          esac
+        else
+          ((nargs++))
+        fi
+        ;;
+    esac
+  done
+
+  case "${words[CURRENT-1]}" in
+    %[1]s) _files; return ;;
+    -theme|--theme) _alternative 'themes:theme:(%[5]s)' 'files:file:_files'; return ;;
+    %[2]s) return ;;
+  esac
+
+  if [[ "${words[CURRENT]}" == -* ]]; then
+    case "$cmd" in
+`, valueFlagPatterns(true), valueFlagPatterns(false), strings.Join(commandNames(), "|"), commandGraph, strings.Join(builtinThemeNames(), " "))
+	for _, cmd := range commands() {
+		pattern := cmd.name
+		if cmd.name == commandGraph {
+			pattern += `|""`
+		}
+		flags := []string{}
+		for _, f := range commandFlags(cmd) {
+			flags = append(flags, zshQuote("--"+f.name+":"+f.usage))
+		}
+		fmt.Fprintf(w, "      %s) flags=(%s) ;;\n", pattern, strings.Join(flags, " "))
+	}
+	fmt.Fprintf(w, `    esac
+    _describe -t flags 'flag' flags
+    return
+  fi
+
+  case "$cmd" in
+    "") _describe -t commands 'command' commands; compadd %s ;;
+`, strings.Join(kindAliases(), " "))
+	for _, cmd := range commands() {
+		switch words := completionWords(cmd.name); {
+		case cmd.name == commandHelp:
+			fmt.Fprintf(w, "    %s) (( nargs == 0 )) && _describe -t commands 'command' commands ;;\n", cmd.name)
+		case words != nil:
+			fmt.Fprintf(w, "    %s) (( nargs == 0 )) && compadd %s ;;\n", cmd.name, strings.Join(words, " "))
+		}
+	}
+	fmt.Fprint(w, `  esac
+}
+
+if [ "$funcstack[1]" = "_rback" ]; then
+  _rback "$@"
+else
+  compdef _rback rback
+fi
+`)
+}
+
+// zshQuote quotes the value for zsh; colons in the name (before the first colon) aren't expected
+func zshQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func printFishCompletion(w io.Writer) {
+	others := []string{}
+	for _, name := range commandNames() {
+		if name != commandGraph {
+			others = append(others, name)
+		}
+	}
+
+	fmt.Fprint(w, "# fish completion for rback, generated by 'rback completion fish'\ncomplete -c rback -f\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "complete -c rback -n '__fish_use_subcommand' -a %s -d %s\n", cmd.name, fishQuote(cmd.description))
+	}
+	fmt.Fprintf(w, "complete -c rback -n '__fish_use_subcommand' -a %s -d Kind\n", fishQuote(strings.Join(kindAliases(), " ")))
+
+	for _, cmd := range commands() {
+		condition := "__fish_seen_subcommand_from " + cmd.name
+		if cmd.name == commandGraph {
+			condition = "not __fish_seen_subcommand_from " + strings.Join(others, " ")
+		}
+		if words := completionWords(cmd.name); words != nil && cmd.name != commandGraph {
+			fmt.Fprintf(w, "complete -c rback -n %s -a %s\n", fishQuote(condition), fishQuote(strings.Join(words, " ")))
+		}
+		for _, f := range commandFlags(cmd) {
+			option := "-l " + f.name
+			if len(f.name) == 1 {
+				option = "-s " + f.name
+			}
+			if f.hasValue {
+				option += " -r"
+			}
+			if contains(fileFlags, f.name) {
+				option += " -F"
+			}
+			if f.name == "theme" {
+				option += " -a " + fishQuote(strings.Join(builtinThemeNames(), " "))
+			}
+			fmt.Fprintf(w, "complete -c rback -n %s %s -d %s\n", fishQuote(condition), option, fishQuote(f.usage))
+		}
+	}
+	fmt.Fprintf(w, "complete -c rback -n '__fish_seen_subcommand_from %s' -a %s -d Kind\n", commandGraph, fishQuote(strings.Join(kindAliases(), " ")))
+}
+
+func fishQuote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const projectConfigFileName = ".rback.yaml"
+
+// ConfigFile contains the defaults and named profiles of a configuration file, e.g.:
+//
+//	defaults:
+//	  ignorePrefixes: ["system:"]
+//	  theme: dark
+//	profiles:
+//	  prod-audit:
+//	    namespaces: ["prod-*"]
+//	    ignorePrefixes: []
+//	    output: json
+//	  docs:
+//	    theme: colorblind
+//	    showLegend: false
+type ConfigFile struct {
+	Defaults Settings            `yaml:"defaults"`
+	Profiles map[string]Settings `yaml:"profiles"`
+}
+
+// Settings are the defaults for flags; settings that aren't set keep the flags' defaults
+type Settings struct {
+	Namespaces        []string  `yaml:"namespaces"`
+	NamespaceSelector *string   `yaml:"namespaceSelector"`
+	Selector          *string   `yaml:"selector"`
+	IgnorePrefixes    *[]string `yaml:"ignorePrefixes"` // an empty list doesn't ignore anything
+	Output            *string   `yaml:"output"`
+	Theme             *string   `yaml:"theme"`
+	URLTemplate       *string   `yaml:"urlTemplate"`
+	ShowLegend        *bool     `yaml:"showLegend"`
+	ShowRules         *bool     `yaml:"showRules"`
+	ShowWorkloads     *bool     `yaml:"showWorkloads"`
+	ShowSecrets       *bool     `yaml:"showSecrets"`
+	RawRules          *bool     `yaml:"rawRules"`
+	Depth             *int      `yaml:"depth"`
+	Summary           *bool     `yaml:"summary"`
+	CollapseSubjects  *int      `yaml:"collapseSubjects"`
+	MaxNodes          *int      `yaml:"maxNodes"`
+	TreeRoot          *string   `yaml:"treeRoot"`
+	Color             *string   `yaml:"color"`
+}
+
+// applyConfigFiles applies the defaults of the user's and the project's configuration file (in this order), followed
+// by the given profile, which may be defined in either file (if defined in both, the project's profile wins)
+func applyConfigFiles(config *Config, values *flagValues, profile string) error {
+	files := []ConfigFile{}
+	for _, path := range configFilePaths() {
+		file, found, err := loadConfigFile(path)
+		if err != nil {
+			return err
+		}
+		if found {
+			files = append(files, file)
+		}
+	}
+
+	for _, file := range files {
+		file.Defaults.apply(config, values)
+	}
+	if profile == "" {
+		return nil
+	}
+
+	profileFound := false
+	profiles := map[string]bool{}
+	for _, file := range files {
+		for name := range file.Profiles {
+			profiles[name] = true
+		}
+	}
+	for i := len(files) - 1; i >= 0 && !profileFound; i-- {
+		if settings, found := files[i].Profiles[profile]; found {
+			settings.apply(config, values)
+			profileFound = true
+		}
+	}
+	if !profileFound {
+		return fmt.Errorf("Unknown profile %q (defined profiles: %s)", profile, strings.Join(sortedKeys(profiles), ", "))
+	}
+	return nil
+}
+
+// configFilePaths returns the paths of the user's configuration file ($XDG_CONFIG_HOME/rback/config.yaml or
+// ~/.config/rback/config.yaml) and of the project's .rback.yaml (in the current directory or its closest parent)
+func configFilePaths() []string {
+	paths := []string{}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, "rback", "config.yaml"))
+	}
+
+	if dir, err := os.Getwd(); err == nil {
+		for {
+			path := filepath.Join(dir, projectConfigFileName)
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return paths
+}
+
+func loadConfigFile(path string) (ConfigFile, bool, error) {
+	var file ConfigFile
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return file, false, nil
+	}
+	if err != nil {
+		return file, false, fmt.Errorf("Can't read config file %s: %v", path, err)
+	}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return file, false, fmt.Errorf("Can't parse config file %s: %v", path, err)
+	}
+	return file, true, nil
+}
+
+func (s Settings) apply(config *Config, values *flagValues) {
+	if s.Namespaces != nil {
+		values.namespaces = strings.Join(s.Namespaces, ",")
+	}
+	setString(&values.namespaceSelector, s.NamespaceSelector)
+	setString(&values.selector, s.Selector)
+	if s.IgnorePrefixes != nil {
+		values.ignoredPrefixes = strings.Join(*s.IgnorePrefixes, ",")
+		if len(*s.IgnorePrefixes) == 0 {
+			values.ignoredPrefixes = "none"
+		}
+	}
+	setString(&config.outputFormat, s.Output)
+	setString(&values.themeName, s.Theme)
+	setString(&values.urlTemplate, s.URLTemplate)
+	setBool(&config.showLegend, s.ShowLegend)
+	setBool(&config.showRules, s.ShowRules)
+	setBool(&config.showWorkloads, s.ShowWorkloads)
+	setBool(&config.showSecrets, s.ShowSecrets)
+	setBool(&config.rawRules, s.RawRules)
+	setInt(&config.depth, s.Depth)
+	setBool(&config.summary, s.Summary)
+	setInt(&config.collapseSubjects, s.CollapseSubjects)
+	setInt(&config.maxNodes, s.MaxNodes)
+	setString(&config.treeRoot, s.TreeRoot)
+	setString(&config.color, s.Color)
+}
+
+func setString(target *string, value *string) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+func setBool(target *bool, value *bool) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+func setInt(target *int, value *int) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+// profileFromArgs returns the value of the --profile flag (or $RBACK_PROFILE), which has to be known before
+// the other flags are parsed, since their defaults depend on the profile
+func profileFromArgs(args []string) string {
+	profile := os.Getenv("RBACK_PROFILE")
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if len(name) == len(arg) || len(arg)-len(name) > 2 {
+			continue // not a flag
+		}
+		if name == "profile" && i+1 < len(args) {
+			profile = args[i+1]
+		} else if strings.HasPrefix(name, "profile=") {
+			profile = strings.TrimPrefix(name, "profile=")
+		}
+	}
+	return profile
+}
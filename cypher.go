@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cypherNode is a node of the graph database; all nodes have the label RBAC and a unique key
+type cypherNode struct {
+	key        string
+	labels     []string
+	properties []cypherProperty
+}
+
+// cypherProperty is a property with a string, bool or []string value
+type cypherProperty struct {
+	name  string
+	value interface{}
+}
+
+type cypherRelationship struct {
+	from, relationshipType, to string
+	properties                 []cypherProperty
+}
+
+// cypherGraph is the model of the RBAC resources for graph databases: subjects are BOUND_BY bindings, which GRANT
+// roles (in a scope), which HAVE_RULEs; namespaced objects are IN_NAMESPACE namespaces
+type cypherGraph struct {
+	nodes         map[string]cypherNode
+	relationships []cypherRelationship
+}
+
+// addNode adds the node unless there's already a node with the key; it returns whether the node was added
+func (g *cypherGraph) addNode(key string, labels []string, properties ...cypherProperty) bool {
+	if _, found := g.nodes[key]; found {
+		return false
+	}
+	unique := []string{}
+	for _, label := range labels {
+		if !contains(unique, label) {
+			unique = append(unique, label)
+		}
+	}
+	g.nodes[key] = cypherNode{key, unique, properties}
+	return true
+}
+
+func (g *cypherGraph) addRelationship(from, relationshipType, to string, properties ...cypherProperty) {
+	g.relationships = append(g.relationships, cypherRelationship{from, relationshipType, to, properties})
+}
+
+// addNamespaced adds a namespaced object along with its namespace, unless it has already been added
+func (g *cypherGraph) addNamespaced(key string, labels []string, namespace, name string, properties ...cypherProperty) {
+	if !g.addNode(key, labels, append([]cypherProperty{{"namespace", namespace}, {"name", name}}, properties...)...) {
+		return
+	}
+	if namespace != "" {
+		g.addNode(nodeID(kindNamespace, "", namespace), []string{"Namespace"}, cypherProperty{"name", namespace})
+		g.addRelationship(key, "IN_NAMESPACE", nodeID(kindNamespace, "", namespace))
+	}
+}
+
+// cypherGraph returns the model of the RBAC resources in the selected namespaces
+func (r *Rback) cypherGraph() *cypherGraph {
+	g := &cypherGraph{nodes: map[string]cypherNode{}}
+
+	for _, ns := range r.allNamespaceNames() {
+		if !r.namespaceSelected(ns) {
+			continue
+		}
+		namespace, exists := r.permissions.Namespaces[ns]
+		g.addNode(nodeID(kindNamespace, "", ns), []string{"Namespace"}, cypherProperty{"name", ns},
+			cypherProperty{"exists", exists || len(r.permissions.Namespaces) == 0}, cypherProperty{"phase", namespace.phase})
+	}
+
+	for ns, sas := range r.permissions.ServiceAccounts {
+		if !r.namespaceSelected(ns) {
+			continue
+		}
+		for name := range sas {
+			g.addNamespaced(nodeID("ServiceAccount", ns, name), []string{"Subject", "ServiceAccount"}, ns, name, cypherProperty{"exists", true})
+		}
+	}
+
+	for ns, roles := range r.permissions.Roles {
+		if ns != "" && !r.namespaceSelected(ns) {
+			continue
+		}
+		for _, role := range roles {
+			r.addCypherRole(g, role.NamespacedName)
+		}
+	}
+
+	for ns, bindings := range r.permissions.RoleBindings {
+		if ns != "" && !r.namespaceSelected(ns) {
+			continue
+		}
+		for _, binding := range bindings {
+			kind := iff(ns == "", "ClusterRoleBinding", "RoleBinding")
+			bindingKey := nodeID(kind, ns, binding.name)
+			g.addNamespaced(bindingKey, []string{"Binding", kind}, ns, binding.name)
+
+			roleKey := r.addCypherRole(g, binding.role)
+			g.addRelationship(bindingKey, "GRANTS", roleKey, cypherProperty{"scope", scopeString(ns)})
+
+			for _, subject := range binding.subjects {
+				subjectKey := nodeID(subject.kind, subject.namespace, subject.name)
+				exists := r.subjectExists(subject.kind, subject.namespace, subject.name)
+				g.addNamespaced(subjectKey, []string{"Subject", subject.kind}, subject.namespace, subject.name, cypherProperty{"exists", exists})
+				g.addRelationship(subjectKey, "BOUND_BY", bindingKey)
+			}
+		}
+	}
+
+	sort.Slice(g.relationships, func(i, j int) bool {
+		a, b := g.relationships[i], g.relationships[j]
+		return a.from+"\x00"+a.relationshipType+"\x00"+a.to < b.from+"\x00"+b.relationshipType+"\x00"+b.to
+	})
+	return g
+}
+
+// addCypherRole adds the (possibly missing) role and its rules, and returns its key
+func (r *Rback) addCypherRole(g *cypherGraph, roleRef NamespacedName) string {
+	kind := iff(roleRef.namespace == "", "ClusterRole", "Role")
+	key := nodeID(kind, roleRef.namespace, roleRef.name)
+	if _, added := g.nodes[key]; added {
+		return key
+	}
+
+	role, exists := r.permissions.Roles[roleRef.namespace][roleRef.name]
+	g.addNamespaced(key, []string{"Role", kind}, roleRef.namespace, roleRef.name, cypherProperty{"exists", exists})
+	rules := role.rules
+	if !r.config.rawRules {
+		rules = normalizeRules(rules)
+	}
+	for i, rule := range rules {
+		ruleKey := fmt.Sprintf("%s#%d", rulesNodeID(kind, roleRef.namespace, roleRef.name), i)
+		g.addNode(ruleKey, []string{"Rule"},
+			cypherProperty{"verbs", nonNil(rule.verbs)},
+			cypherProperty{"apiGroups", nonNil(rule.apiGroups)},
+			cypherProperty{"resources", nonNil(rule.resources)},
+			cypherProperty{"resourceNames", nonNil(rule.resourceNames)},
+			cypherProperty{"nonResourceURLs", nonNil(rule.nonResourceURLs)},
+			cypherProperty{"text", rule.toHumanReadableString()})
+		g.addRelationship(key, "HAS_RULE", ruleKey)
+	}
+	return key
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func (g *cypherGraph) sortedKeys() []string {
+	keys := []string{}
+	for key := range g.nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeCypher writes Cypher statements that MERGE the nodes and relationships, so that running them again updates
+// the graph database instead of duplicating the nodes
+func (r *Rback) writeCypher(w io.Writer) error {
+	g := r.cypherGraph()
+	fmt.Fprintln(w, "CREATE INDEX rback_key IF NOT EXISTS FOR (n:RBAC) ON (n.key);")
+	for _, key := range g.sortedKeys() {
+		node := g.nodes[key]
+		properties := []string{}
+		for _, p := range node.properties {
+			properties = append(properties, p.name+": "+cypherValue(p.value))
+		}
+		fmt.Fprintf(w, "MERGE (n:RBAC {key: %s}) SET n:%s SET n += {%s};\n", cypherValue(key), strings.Join(node.labels, ":"), strings.Join(properties, ", "))
+	}
+	for _, rel := range g.relationships {
+		properties := []string{}
+		for _, p := range rel.properties {
+			properties = append(properties, p.name+": "+cypherValue(p.value))
+		}
+		set := ""
+		if len(properties) > 0 {
+			set = " SET r += {" + strings.Join(properties, ", ") + "}"
+		}
+		_, err := fmt.Fprintf(w, "MATCH (a:RBAC {key: %s}), (b:RBAC {key: %s}) MERGE (a)-[r:%s]->(b)%s;\n", cypherValue(rel.from), cypherValue(rel.to), rel.relationshipType, set)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cypherValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+	case []string:
+		values := []string{}
+		for _, s := range v {
+			values = append(values, cypherValue(s))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+// cypherCSVProperties are the properties of the nodes in the CSV files, with their neo4j-admin import types
+var cypherCSVProperties = []string{"namespace", "name", "exists:boolean", "phase", "verbs:string[]", "apiGroups:string[]", "resources:string[]", "resourceNames:string[]", "nonResourceURLs:string[]", "text"}
+
+// writeCypherCSV writes nodes.csv and relationships.csv for `neo4j-admin database import` to the directory
+func (r *Rback) writeCypherCSV(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	g := r.cypherGraph()
+
+	nodes := [][]string{append([]string{"key:ID", ":LABEL"}, cypherCSVProperties...)}
+	for _, key := range g.sortedKeys() {
+		node := g.nodes[key]
+		row := []string{key, strings.Join(append([]string{"RBAC"}, node.labels...), ";")}
+		for _, column := range cypherCSVProperties {
+			row = append(row, csvValue(node.properties, strings.Split(column, ":")[0]))
+		}
+		nodes = append(nodes, row)
+	}
+
+	relationships := [][]string{{":START_ID", ":TYPE", ":END_ID", "scope"}}
+	for _, rel := range g.relationships {
+		relationships = append(relationships, []string{rel.from, rel.relationshipType, rel.to, csvValue(rel.properties, "scope")})
+	}
+
+	if err := writeCSV(filepath.Join(dir, "nodes.csv"), nodes); err != nil {
+		return err
+	}
+	return writeCSV(filepath.Join(dir, "relationships.csv"), relationships)
+}
+
+func csvValue(properties []cypherProperty, name string) string {
+	for _, p := range properties {
+		if p.name == name {
+			if values, isList := p.value.([]string); isList {
+				return strings.Join(values, ";")
+			}
+			return fmt.Sprint(p.value)
+		}
+	}
+	return ""
+}
+
+func writeCSV(file string, rows [][]string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(f)
+	writer.WriteAll(rows)
+	if err := writer.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
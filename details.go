@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/emicklei/dot"
+)
+
+// maxTooltipLineLength limits the length of label and annotation values in tooltips (e.g. embedded JSON documents)
+const maxTooltipLineLength = 200
+
+// URLTemplateData is passed to the --url-template when creating the URL of a node
+type URLTemplateData struct {
+	Kind      string // e.g. ClusterRole
+	Resource  string // e.g. clusterroles
+	Namespace string // empty for cluster-scoped objects
+	Name      string
+}
+
+// addDetails sets the tooltip of the node (or namespace cluster), and its URL if a --url-template is configured
+// and the object exists (Users and Groups are never linked, since they aren't Kubernetes objects)
+func (r *Rback) addDetails(attributes dot.AttributesMap, kind, namespace, name string, exists bool, tooltip []string) {
+	if len(tooltip) > 0 {
+		attributes.Attr("tooltip", strings.Join(tooltip, "\n"))
+	}
+	if r.config.urlTemplate == nil || !exists || kind == "User" || kind == "Group" {
+		return
+	}
+	var url bytes.Buffer
+	data := URLTemplateData{kind, strings.ToLower(kind) + "s", namespace, name}
+	if err := r.config.urlTemplate.Execute(&url, data); err == nil && url.Len() > 0 {
+		attributes.Attr("URL", url.String())
+	}
+}
+
+func parseURLTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("url").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// fail early on references to unknown fields
+	return tmpl, tmpl.Execute(&bytes.Buffer{}, URLTemplateData{"Role", "roles", "ns", "name"})
+}
+
+func (r *Rback) subjectTooltip(kind, ns, name string, exists bool) []string {
+	tooltip := []string{kind + " " + qualifiedName(ns, name)}
+	if !exists {
+		return append(tooltip, "(missing)")
+	}
+	if kind == "ServiceAccount" {
+		if sa, found := r.serviceAccount(ns, name); found {
+			if r.serviceAccountAutomountsToken(ns, name) {
+				tooltip = append(tooltip, "automountServiceAccountToken: not disabled")
+			}
+			tooltip = append(tooltip, toObjectMeta(getMetadata(sa)).tooltip()...)
+		}
+	}
+	return tooltip
+}
+
+func namespaceTooltip(namespace Namespace) []string {
+	tooltip := []string{"Namespace " + namespace.name, "Phase: " + namespace.phase}
+	return append(tooltip, namespace.ObjectMeta.tooltip()...)
+}
+
+func bindingTooltip(binding Binding) []string {
+	tooltip := []string{bindingString(binding), "Role: " + roleString(binding.role)}
+	if len(binding.subjects) > 0 {
+		tooltip = append(tooltip, "Subjects:")
+		for _, subject := range binding.subjects {
+			tooltip = append(tooltip, "  "+subjectString(subject))
+		}
+	}
+	if binding.ignoredSubjects > 0 {
+		tooltip = append(tooltip, pluralize(binding.ignoredSubjects, "ignored subject"))
+	}
+	return append(tooltip, binding.ObjectMeta.tooltip()...)
+}
+
+func (r *Rback) roleTooltip(roleRef NamespacedName) []string {
+	tooltip := []string{roleString(roleRef)}
+	role, exists := r.permissions.Roles[roleRef.namespace][roleRef.name]
+	if !exists {
+		return append(tooltip, "(missing)")
+	}
+	tooltip = append(tooltip, role.ObjectMeta.tooltip()...)
+	return append(tooltip, rulesTooltip(role)...)
+}
+
+// rulesTooltip lists all rules of the role, including the ones hidden by --show-matched-rules-only
+func rulesTooltip(role Role) []string {
+	tooltip := []string{"Rules:"}
+	for _, rule := range role.rules {
+		tooltip = append(tooltip, "  "+rule.toHumanReadableString())
+	}
+	return tooltip
+}
+
+func secretTooltip(secret Secret) []string {
+	tooltip := []string{"Secret " + qualifiedName(secret.namespace, secret.name)}
+	if secret.secretType != "" {
+		tooltip = append(tooltip, "Type: "+secret.secretType)
+	}
+	if secret.serviceAccountName != "" {
+		tooltip = append(tooltip, "Token of ServiceAccount "+secret.serviceAccountName)
+	}
+	return append(tooltip, secret.ObjectMeta.tooltip()...)
+}
+
+func workloadTooltip(workload Workload) []string {
+	tooltip := []string{workload.kind + " " + qualifiedName(workload.namespace, workload.name), "ServiceAccount: " + workload.serviceAccountName}
+	if workload.automountServiceAccountToken != nil && !*workload.automountServiceAccountToken {
+		tooltip = append(tooltip, "automountServiceAccountToken: false")
+	}
+	if workload.controller != nil {
+		tooltip = append(tooltip, "Controlled by: "+workload.controller.kind+" "+workload.controller.name)
+	}
+	return append(tooltip, workload.ObjectMeta.tooltip()...)
+}
+
+func (m ObjectMeta) tooltip() []string {
+	tooltip := []string{}
+	if m.created != "" {
+		tooltip = append(tooltip, "Created: "+m.created)
+	}
+	if len(m.labels) > 0 {
+		tooltip = append(tooltip, "Labels:")
+		for _, l := range formatLabels(m.labels) {
+			tooltip = append(tooltip, "  "+truncate(l, maxTooltipLineLength))
+		}
+	}
+	annotations := visibleAnnotations(m.annotations)
+	if len(annotations) > 0 {
+		tooltip = append(tooltip, "Annotations:")
+		for _, a := range annotations {
+			tooltip = append(tooltip, "  "+truncate(a, maxTooltipLineLength))
+		}
+	}
+	return tooltip
+}
+
+// truncate shortens the string to the given number of characters (not bytes, so that characters aren't split)
+func truncate(str string, length int) string {
+	runes := []rune(str)
+	if len(runes) <= length {
+		return str
+	}
+	return string(runes[:length]) + "..."
+}
@@ -2,4 +2,7 @@ module github.com/mhausenblas/rback
 
 go 1.12
 
-require github.com/emicklei/dot v0.10.0
+require (
+	github.com/emicklei/dot v0.10.0
+	gopkg.in/yaml.v2 v2.2.2
+)
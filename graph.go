@@ -2,88 +2,171 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/emicklei/dot"
 )
 
-func newGraph() *dot.Graph {
+func (r *Rback) newGraph() *dot.Graph {
 	g := dot.NewGraph(dot.Directed)
 	g.Attr("newrank", "true") // global rank instead of per-subgraph (ensures access rules are always in the same place (at bottom))
+	r.config.theme.applyToGraph(g)
 	return g
 }
 
-func newNamespaceSubgraph(g *dot.Graph, ns string) *dot.Graph {
+const (
+	phaseTerminating = "Terminating"
+	phaseMissing     = "Missing" // internal phase for namespaces that are referenced, but don't exist
+)
+
+func (r *Rback) newNamespaceSubgraph0(g *dot.Graph, ns string, labels map[string]string, phase string) *dot.Graph {
+	theme := r.config.theme
 	if ns == "" {
 		return g
 	}
 	gns := g.Subgraph(ns, dot.ClusterOption{})
 	gns.Attr("style", "dashed")
+	theme.apply(theme.Namespace, gns.AttributesMap)
+
+	label := "<b>" + escapeHTML(ns) + "</b>"
+	if phase == phaseMissing || phase == phaseTerminating {
+		label += escapeHTML(fmt.Sprintf(" (%s)", phase))
+	}
+	for _, l := range formatLabels(labels) {
+		label += `<br/><font point-size="10">` + escapeHTML(l) + `</font>`
+	}
+	gns.Attr("label", dot.HTML(label))
+
+	switch phase {
+	case phaseMissing:
+		gns.Attr("style", "dashed,filled")
+		theme.apply(theme.MissingNamespace, gns.AttributesMap)
+	case phaseTerminating:
+		gns.Attr("style", "dashed,filled")
+		theme.apply(theme.TerminatingNamespace, gns.AttributesMap)
+	}
 	return gns
 }
 
-func newSubjectNode0(g *dot.Graph, kind, name string, exists, highlight bool) dot.Node {
-	return g.Node(kind+"-"+name).
-		Box().
-		Attr("label", formatLabel(fmt.Sprintf("%s\n(%s)", name, kind), highlight)).
-		Attr("style", iff(exists, "filled", "dotted")).
-		Attr("color", iff(exists, "black", "red")).
-		Attr("penwidth", iff(highlight || !exists, "2.0", "1.0")).
-		Attr("fillcolor", "#2f6de1").
-		Attr("fontcolor", iff(exists, "#f0f0f0", "#030303"))
-}
-
-func newRoleBindingNode(g *dot.Graph, name string, highlight bool) dot.Node {
-	return g.Node("rb-"+name).
-		Attr("label", formatLabel(name, highlight)).
-		Attr("shape", "octagon").
-		Attr("style", "filled").
-		Attr("penwidth", iff(highlight, "2.0", "1.0")).
-		Attr("fillcolor", "#ffcc00").
-		Attr("fontcolor", "#030303")
-}
-
-func newClusterRoleBindingNode(g *dot.Graph, name string, highlight bool) dot.Node {
-	return g.Node("crb-"+name).
-		Attr("label", formatLabel(name, highlight)).
-		Attr("shape", "doubleoctagon").
-		Attr("style", "filled").
-		Attr("penwidth", iff(highlight, "2.0", "1.0")).
-		Attr("fillcolor", "#ffcc00").
-		Attr("fontcolor", "#030303")
-}
-
-func newRoleNode(g *dot.Graph, namespace, name string, exists, highlight bool) dot.Node {
-	node := g.Node("r-"+namespace+"/"+name).
-		Attr("label", formatLabel(name, highlight)).
-		Attr("shape", "octagon").
-		Attr("style", iff(exists, "filled", "dotted")).
-		Attr("color", iff(exists, "black", "red")).
-		Attr("penwidth", iff(highlight || !exists, "2.0", "1.0")).
-		Attr("fillcolor", "#ff9900").
-		Attr("fontcolor", "#030303")
+// visibleAnnotations returns the formatted annotations, except for the (huge) last applied configuration
+func visibleAnnotations(annotations map[string]string) []string {
+	visible := []string{}
+	for _, a := range formatLabels(annotations) {
+		if !strings.HasPrefix(a, "kubectl.kubernetes.io/last-applied-configuration=") {
+			visible = append(visible, a)
+		}
+	}
+	return visible
+}
+
+// nodeID returns the ID of the node representing the given resource. The namespace and name are escaped,
+// so that IDs are unique even if names contain slashes (e.g. usernames).
+func nodeID(kind, namespace, name string) string {
+	return strings.ToLower(kind) + ":" + url.PathEscape(namespace) + "/" + url.PathEscape(name)
+}
+
+func rulesNodeID(roleKind, namespace, roleName string) string {
+	return kindRule + "-" + nodeID(roleKind, namespace, roleName)
+}
+
+// newSubjectNode0 creates the node of a subject; the note (if any) is shown below the kind
+func (r *Rback) newSubjectNode0(g *dot.Graph, kind, namespace, name, note string, exists, highlight bool) dot.Node {
+	label := fmt.Sprintf("%s\n(%s)", name, kind)
+	if note != "" {
+		label += "\n" + note
+	}
+	return r.styledNode(g.Node(nodeID(kind, namespace, name)), themeSubject, exists, highlight).
+		Attr("label", formatLabel(label, highlight))
+}
+
+func (r *Rback) newWorkloadNode(g *dot.Graph, kind, namespace, name string) dot.Node {
+	return r.styledNode(g.Node(nodeID(kind, namespace, name)), themeWorkload, true, false).
+		Attr("label", fmt.Sprintf("%s\n(%s)", name, kind))
+}
+
+// newSecretNode0 creates the node of a Secret referenced by a ServiceAccount; legacy (long-lived) token Secrets
+// are styled differently
+func (r *Rback) newSecretNode0(g *dot.Graph, namespace, name string, exists, legacyToken bool) dot.Node {
+	kind := iff(legacyToken, themeLegacyTokenSecret, themeSecret)
+	return r.styledNode(g.Node(nodeID(kindSecret, namespace, name)), kind, exists, false).
+		Attr("label", fmt.Sprintf("%s\n(%s)", name, iff(legacyToken, "legacy token Secret", "Secret")))
+}
+
+// newCollapsedSubjectsNode0 creates a single node standing for the given number of subjects of a binding
+func (r *Rback) newCollapsedSubjectsNode0(g *dot.Graph, id, kind string, count int) dot.Node {
+	style := r.config.theme.Nodes[themeSubject]
+	style.PenWidth = ""
+	return r.styledNode0(g.Node(id), style).
+		Attr("label", fmt.Sprintf("%d %ss", count, kind)).
+		Attr("peripheries", "2")
+}
+
+// newNamespaceSummaryNode0 creates a single node standing for all the resources in a (collapsed) namespace
+func (r *Rback) newNamespaceSummaryNode0(g *dot.Graph, ns string, counts []string, phase string) dot.Node {
+	theme := r.config.theme
+	label := ns
+	if phase == phaseMissing || phase == phaseTerminating {
+		label += fmt.Sprintf(" (%s)", phase)
+	}
+	node := g.Node(nodeID(kindNamespace, "", ns))
+	theme.apply(theme.Nodes[themeNamespaceSummary], node.AttributesMap)
+	switch phase {
+	case phaseMissing:
+		setAttr(node.AttributesMap, "color", theme.MissingNamespace.Color)
+	case phaseTerminating:
+		setAttr(node.AttributesMap, "color", theme.TerminatingNamespace.Color)
+	}
+	return node.
+		Attr("label", label+"\n"+strings.Join(counts, "\n")).
+		Attr("style", iff(phase == phaseMissing, "dashed", "solid"))
+}
+
+func (r *Rback) newRoleBindingNode(g *dot.Graph, namespace, name string, highlight bool) dot.Node {
+	return r.styledNode(g.Node(nodeID(kindRoleBinding, namespace, name)), themeRoleBinding, true, highlight).
+		Attr("label", formatLabel(name, highlight))
+}
+
+func (r *Rback) newClusterRoleBindingNode(g *dot.Graph, name string, highlight bool) dot.Node {
+	return r.styledNode(g.Node(nodeID(kindClusterRoleBinding, "", name)), themeClusterRoleBinding, true, highlight).
+		Attr("label", formatLabel(name, highlight))
+}
+
+func (r *Rback) newRoleNode(g *dot.Graph, namespace, name string, exists, highlight bool) dot.Node {
+	node := r.styledNode(g.Node(nodeID(kindRole, namespace, name)), themeRole, exists, highlight).
+		Attr("label", formatLabel(name, highlight))
 	g.Root().AddToSameRank("Roles", node)
 	return node
 }
 
-func newClusterRoleNode(g *dot.Graph, bindingNamespace, roleName string, exists, highlight bool) dot.Node {
-	node := g.Node("cr-"+bindingNamespace+"/"+roleName).
-		Attr("label", formatLabel(roleName, highlight)).
-		Attr("shape", "doubleoctagon").
-		Attr("style", iff(exists, iff(bindingNamespace == "", "filled", "filled,dashed"), "dotted")).
-		Attr("color", iff(exists, "black", "red")).
-		Attr("penwidth", iff(highlight || !exists, "2.0", "1.0")).
-		Attr("fillcolor", "#ff9900").
-		Attr("fontcolor", "#030303")
+func (r *Rback) newClusterRoleNode(g *dot.Graph, bindingNamespace, roleName string, exists, highlight bool) dot.Node {
+	node := r.styledNode(g.Node(nodeID(kindClusterRole, bindingNamespace, roleName)), themeClusterRole, exists, highlight).
+		Attr("label", formatLabel(roleName, highlight))
+	if exists && bindingNamespace != "" {
+		node.Attr("style", "filled,dashed")
+	}
 	g.Root().AddToSameRank("Roles", node)
 	return node
 }
 
-func newRulesNode0(g *dot.Graph, namespace, roleName, rulesHTML string, highlight bool) dot.Node {
-	return g.Node("rules-"+namespace+"/"+roleName).
-		Attr("label", dot.HTML(rulesHTML)).
-		Attr("shape", "note").
-		Attr("penwidth", iff(highlight, "2.0", "1.0"))
+// newRulesNode0 creates the node listing the rules of a role; roleKind and namespace must be the ones used to
+// create the role node (i.e. the binding's namespace for ClusterRoles bound by RoleBindings)
+func (r *Rback) newRulesNode0(g *dot.Graph, roleKind, namespace, roleName, rulesHTML string, highlight bool) dot.Node {
+	node := g.Node(rulesNodeID(roleKind, namespace, roleName))
+	r.config.theme.apply(r.config.theme.nodeStyle(themeRules, true, highlight), node.AttributesMap)
+	return node.Attr("label", dot.HTML(rulesHTML))
+}
+
+// styledNode styles a node with the theme's style for the given kind of node; nodes are filled, unless the
+// style says otherwise
+func (r *Rback) styledNode(node dot.Node, kind string, exists, highlight bool) dot.Node {
+	return r.styledNode0(node, r.config.theme.nodeStyle(kind, exists, highlight))
+}
+
+func (r *Rback) styledNode0(node dot.Node, style NodeStyle) dot.Node {
+	node.Attr("style", "filled")
+	r.config.theme.apply(style, node.AttributesMap)
+	return node
 }
 
 func regularLine(str string) string {
@@ -110,23 +193,37 @@ func escapeHTML(str string) string {
 	return str
 }
 
-func newSubjectToBindingEdge(subjectNode dot.Node, bindingNode dot.Node) dot.Edge {
-	return edge(subjectNode, bindingNode).Attr("dir", "back")
+func (r *Rback) newSubjectToBindingEdge(subjectNode dot.Node, bindingNode dot.Node) dot.Edge {
+	return r.edge(subjectNode, bindingNode).Attr("dir", "back")
+}
+
+// newWorkloadToServiceAccountEdge links a workload to the ServiceAccount it runs as; the edge is dashed
+// if the workload explicitly opts out of mounting the ServiceAccount's token
+func (r *Rback) newWorkloadToServiceAccountEdge(workloadNode dot.Node, saNode dot.Node, automountToken bool) dot.Edge {
+	return r.edge(workloadNode, saNode).Attr("style", iff(automountToken, "solid", "dashed"))
+}
+
+// newServiceAccountToSecretEdge links a ServiceAccount to a Secret it references; the edge is dotted for image
+// pull Secrets
+func (r *Rback) newServiceAccountToSecretEdge(saNode dot.Node, secretNode dot.Node, imagePull bool) dot.Edge {
+	return r.edge(saNode, secretNode).Attr("style", iff(imagePull, "dotted", "solid"))
 }
 
-func newBindingToRoleEdge(bindingNode dot.Node, roleNode dot.Node) dot.Edge {
-	return edge(bindingNode, roleNode)
+func (r *Rback) newBindingToRoleEdge(bindingNode dot.Node, roleNode dot.Node) dot.Edge {
+	return r.edge(bindingNode, roleNode)
 }
 
-func newRoleToRulesEdge(roleNode dot.Node, rulesNode dot.Node) dot.Edge {
-	return edge(roleNode, rulesNode)
+func (r *Rback) newRoleToRulesEdge(roleNode dot.Node, rulesNode dot.Node) dot.Edge {
+	return r.edge(roleNode, rulesNode)
 }
 
 // edge creates a new edge between two nodes, but only if the edge doesn't exist yet
-func edge(from dot.Node, to dot.Node) dot.Edge {
+func (r *Rback) edge(from dot.Node, to dot.Node) dot.Edge {
 	existingEdges := from.EdgesTo(to)
 	if len(existingEdges) == 0 {
-		return from.Edge(to)
+		e := from.Edge(to)
+		setAttr(e.AttributesMap, "color", r.config.theme.EdgeColor)
+		return e
 	} else {
 		return existingEdges[0]
 	}
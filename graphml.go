@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// The GraphML and GEXF exports contain the nodes and edges genGraph draws (i.e. after applying all filters,
+// collapsing and the node budget), with their attributes, so that tools like yEd and Gephi can lay out and filter
+// graphs too large for GraphViz.
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	XMLNSY  string       `xml:"xmlns:y,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID         string `xml:"id,attr"`
+	For        string `xml:"for,attr"`
+	Name       string `xml:"attr.name,attr,omitempty"`
+	Type       string `xml:"attr.type,attr,omitempty"`
+	YFilesType string `xml:"yfiles.type,attr,omitempty"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+// graphMLShapeNode is yEd's representation of a node, so that yEd shows the labels, missing and focused nodes
+type graphMLShapeNode struct {
+	BorderStyle struct {
+		Type  string `xml:"type,attr"`
+		Width string `xml:"width,attr"`
+	} `xml:"y:BorderStyle"`
+	Label string `xml:"y:NodeLabel"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key       string            `xml:"key,attr"`
+	Value     string            `xml:",chardata"`
+	ShapeNode *graphMLShapeNode `xml:"y:ShapeNode,omitempty"`
+}
+
+// writeGraphML writes the drawn graph in the GraphML format, with yEd's extensions for labels and borders
+func (r *Rback) writeGraphML(w io.Writer) error {
+	r.genGraph()
+	doc := graphML{
+		XMLNS:  "http://graphml.graphdrawing.org/xmlns",
+		XMLNSY: "http://www.yworks.com/xml/graphml",
+		Keys: []graphMLKey{
+			{ID: "label", For: "node", Name: "label", Type: "string"},
+			{ID: "kind", For: "node", Name: "kind", Type: "string"},
+			{ID: "namespace", For: "node", Name: "namespace", Type: "string"},
+			{ID: "name", For: "node", Name: "name", Type: "string"},
+			{ID: "exists", For: "node", Name: "exists", Type: "boolean"},
+			{ID: "focused", For: "node", Name: "focused", Type: "boolean"},
+			{ID: "graphics", For: "node", YFilesType: "nodegraphics"},
+			{ID: "type", For: "edge", Name: "type", Type: "string"},
+		},
+		Graph: graphMLGraph{ID: "rback", EdgeDefault: "directed"},
+	}
+
+	for _, id := range r.sortedRenderedNodeIDs() {
+		node := r.renderedNodes[id]
+		shape := &graphMLShapeNode{Label: node.label()}
+		shape.BorderStyle.Type = iff(node.exists, "line", "dashed")
+		shape.BorderStyle.Width = iff(node.focused, "3.0", "1.0")
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: id,
+			Data: []graphMLData{
+				{Key: "label", Value: node.label()},
+				{Key: "kind", Value: node.kind},
+				{Key: "namespace", Value: node.namespace},
+				{Key: "name", Value: node.name},
+				{Key: "exists", Value: fmt.Sprint(node.exists)},
+				{Key: "focused", Value: fmt.Sprint(node.focused)},
+				{Key: "graphics", ShapeNode: shape},
+			},
+		})
+	}
+	for i, edge := range r.sortedRenderedEdges() {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     fmt.Sprintf("e%d", i),
+			Source: edge.from,
+			Target: edge.to,
+			Data:   []graphMLData{{Key: "type", Value: edge.edgeType}},
+		})
+	}
+	return writeXML(w, doc)
+}
+
+type gexf struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Creator string    `xml:"meta>creator"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Mode            string           `xml:"mode,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfElement    `xml:"nodes>node"`
+	Edges           []gexfElement    `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+// gexfElement is a node or an edge
+type gexfElement struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr,omitempty"`
+	Target    string         `xml:"target,attr,omitempty"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// writeGEXF writes the drawn graph in Gephi's GEXF format
+func (r *Rback) writeGEXF(w io.Writer) error {
+	r.genGraph()
+	doc := gexf{
+		XMLNS:   "http://www.gexf.net/1.2draft",
+		Version: "1.2",
+		Creator: "rback",
+		Graph: gexfGraph{
+			DefaultEdgeType: "directed",
+			Mode:            "static",
+			Attributes: []gexfAttributes{
+				{"node", []gexfAttribute{
+					{"kind", "kind", "string"},
+					{"namespace", "namespace", "string"},
+					{"name", "name", "string"},
+					{"exists", "exists", "boolean"},
+					{"focused", "focused", "boolean"},
+				}},
+				{"edge", []gexfAttribute{{"type", "type", "string"}}},
+			},
+		},
+	}
+
+	for _, id := range r.sortedRenderedNodeIDs() {
+		node := r.renderedNodes[id]
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfElement{
+			ID:    id,
+			Label: node.label(),
+			AttValues: []gexfAttValue{
+				{"kind", node.kind},
+				{"namespace", node.namespace},
+				{"name", node.name},
+				{"exists", fmt.Sprint(node.exists)},
+				{"focused", fmt.Sprint(node.focused)},
+			},
+		})
+	}
+	for i, edge := range r.sortedRenderedEdges() {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfElement{
+			ID:        fmt.Sprintf("e%d", i),
+			Source:    edge.from,
+			Target:    edge.to,
+			Label:     edge.edgeType,
+			AttValues: []gexfAttValue{{"type", edge.edgeType}},
+		})
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// label returns the label of the node in the exports, e.g. "app (serviceaccount)"
+func (node renderedNode) label() string {
+	if node.kind == kindRule {
+		return "rules of " + node.name
+	}
+	return fmt.Sprintf("%s (%s)", node.name, node.kind)
+}
+
+func (r *Rback) sortedRenderedNodeIDs() []string {
+	ids := []string{}
+	for id := range r.renderedNodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (r *Rback) sortedRenderedEdges() []renderedEdge {
+	edges := []renderedEdge{}
+	for edge := range r.renderedEdges {
+		edges = append(edges, edge)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		return a.from < b.from || (a.from == b.from && (a.to < b.to || (a.to == b.to && a.edgeType < b.edgeType)))
+	})
+	return edges
+}
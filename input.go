@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// openInput returns a reader for the input: stdin (if no path is given), a JSON List, or YAML files and directories
+// with JSON and YAML manifests, which are combined into a single List; the caller has to close it
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "" {
+		return os.Stdin, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() && !isYAMLFile(path) {
+		return os.Open(path)
+	}
+
+	files, err := inputFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	items := []interface{}{}
+	for _, file := range files {
+		fileItems, err := readManifests(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		items = append(items, fileItems...)
+	}
+	list, err := json.Marshal(map[string]interface{}{"kind": "List", "items": items})
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(list)), nil
+}
+
+// inputFiles returns the given file, or all JSON and YAML files in the given directory and its subdirectories
+// (except hidden ones), sorted by path
+func inputFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	files := []string{}
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file != path && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && (isYAMLFile(file) || filepath.Ext(file) == ".json") {
+			files = append(files, file)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+func isYAMLFile(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// readManifests returns the objects in the file, which may contain Lists and single objects (for YAML, in multiple
+// documents)
+func readManifests(file string) ([]interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := []interface{}{}
+	if isYAMLFile(file) {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var document interface{}
+			err := decoder.Decode(&document)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			documents = append(documents, fromYAML(document))
+		}
+	} else {
+		var document interface{}
+		if err := json.Unmarshal(data, &document); err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	items := []interface{}{}
+	for _, document := range documents {
+		obj, ok := document.(map[string]interface{})
+		if !ok {
+			continue // e.g. an empty YAML document
+		}
+		if obj["kind"] == "List" {
+			listItems, _ := obj["items"].([]interface{})
+			items = append(items, listItems...)
+		} else if _, hasKind := obj["kind"].(string); hasKind {
+			items = append(items, obj)
+		}
+	}
+	return items, nil
+}
+
+// fromYAML converts the maps decoded from YAML (with interface{} keys) into maps with string keys, as decoded from JSON
+func fromYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, value := range v {
+			result[fmt.Sprint(key)] = fromYAML(value)
+		}
+		return result
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromYAML(item)
+		}
+	}
+	return value
+}
@@ -1,30 +1,63 @@
 package main
 
 import (
-	"flag"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
 	"strings"
+	"text/template"
 )
 
 type Rback struct {
-	config      Config
-	permissions Permissions
+	config              Config
+	permissions         Permissions
+	collapsedNamespaces map[string]bool         // namespaces rendered as a single node
+	renderedNodes       map[string]renderedNode // all nodes drawn by genGraph (except the legend), by ID
+	renderedEdges       map[renderedEdge]bool   // all edges drawn by genGraph (except the legend)
 }
 
 type Config struct {
-	inputFile       string
-	showRules       bool
-	showLegend      bool
-	namespaces      []string
-	ignoredPrefixes []string
-	resourceKind    string
-	resourceNames   []string
-	whoCan          WhoCan
+	command           string
+	inputFile         string
+	outputFile        string
+	watch             bool
+	outputFormat      string
+	auditLogFile      string
+	policyFile        string
+	reviewFiles       []string
+	snapshotFile      string
+	listenAddress     string
+	showRules         bool
+	showLegend        bool
+	showWorkloads     bool
+	showSecrets       bool
+	rawRules          bool
+	namespaces        []string
+	namespaceSelector LabelSelector
+	selector          LabelSelector
+	ignoredPrefixes   []string
+	resourceKind      string
+	resourceNames     []string
+	nameRegex         *regexp.Regexp
+	depth             int
+	summary           bool
+	collapseSubjects  int
+	maxNodes          int
+	treeRoot          string
+	color             string
+	reportFormat      string
+	theme             Theme
+	urlTemplate       *template.Template
+	completionShell   string
+	whoCan            WhoCan
+	flagValues        flagValues // the unparsed values of some flags, used to apply flags of requests in serve
 }
 
 type WhoCan struct {
 	verb, resourceKind, resourceName string
+	apiGroup                         *string // nil matches any API group
+	exactName                        bool    // whether a missing resource name only matches rules without resource names
 	showMatchedOnly                  bool
 }
 
@@ -32,65 +65,78 @@ func main() {
 	config := parseConfigFromArgs()
 	rback := Rback{config: config}
 
-	var err error
-	reader := os.Stdin
-	if config.inputFile != "" {
-		reader, err = os.Open(config.inputFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Can't open file %s: %v\n", config.inputFile, err)
-			os.Exit(-1)
-		}
+	if config.command == commandCompletion {
+		printCompletion(os.Stdout, config.completionShell)
+		return
+	}
+
+	if config.watch {
+		watch(config)
+		return
+	}
+
+	reader, err := openInput(config.inputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't open file %s: %v\n", config.inputFile, err)
+		os.Exit(-1)
 	}
 
 	err = rback.parseRBAC(reader)
+	reader.Close()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Can't parse RBAC resources from stdin: %v\n", err)
 		os.Exit(-1)
 	}
-	g := rback.genGraph()
-	fmt.Println(g.String())
-}
 
-func parseConfigFromArgs() Config {
-	config := Config{}
-	flag.StringVar(&config.inputFile, "f", "", "The name of the file to use as input (otherwise stdin is used)")
-	flag.BoolVar(&config.showLegend, "show-legend", true, "Whether to show the legend or not")
-	flag.BoolVar(&config.showRules, "show-rules", true, "Whether to render RBAC access rules (e.g. \"get pods\") or not")
-	flag.BoolVar(&config.whoCan.showMatchedOnly, "show-matched-rules-only", false, "When running who-can, only show the matched rule instead of all rules specified in the role")
-
-	var namespaces string
-	flag.StringVar(&namespaces, "n", "", "The namespace to render (also supports multiple, comma-delimited namespaces)")
-
-	var ignoredPrefixes string
-	flag.StringVar(&ignoredPrefixes, "ignore-prefixes", "system:", "Comma-delimited list of (Cluster)Role(Binding) prefixes to ignore ('none' to not ignore anything)")
-	flag.Parse()
-
-	if flag.NArg() > 0 {
-		if flag.Arg(0) == "who-can" {
-			if flag.NArg() < 3 {
-				fmt.Println("Usage: rback who-can VERB RESOURCE [NAME]")
-				os.Exit(-4)
-			}
-			config.resourceKind = kindRule
-			config.whoCan.verb = flag.Arg(1)
-			config.whoCan.resourceKind = flag.Arg(2)
-			if flag.NArg() > 3 {
-				config.whoCan.resourceName = flag.Arg(3)
-			}
-		} else {
-			config.resourceKind = normalizeKind(flag.Arg(0))
-			if flag.NArg() > 1 {
-				config.resourceNames = flag.Args()[1:]
-			}
+	if config.command == commandServe {
+		err = rback.serve()
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(-1)
+	}
+
+	if config.outputFormat == outputCypherCSV && config.outputFile != "" {
+		if err := rback.writeCypherCSV(config.outputFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Can't write CSV files to %s: %v\n", config.outputFile, err)
+			os.Exit(-1)
 		}
+		return
 	}
 
-	config.namespaces = strings.Split(namespaces, ",")
+	output := os.Stdout
+	if config.outputFile != "" {
+		output, err = os.Create(config.outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't create file %s: %v\n", config.outputFile, err)
+			os.Exit(-1)
+		}
+		defer output.Close()
+	}
+	if err := rback.run(output); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		output.Close()
+		os.Exit(-1)
+	}
+}
 
-	if ignoredPrefixes != "none" {
-		config.ignoredPrefixes = strings.Split(ignoredPrefixes, ",")
+// run executes the command on the parsed RBAC resources and writes its output to w
+func (r *Rback) run(w io.Writer) error {
+	switch r.config.command {
+	case commandUnused:
+		return r.printUnused(w)
+	case commandSuggest:
+		return r.printSuggestions(w)
+	case commandCheck:
+		return r.printPolicyViolations(w)
+	case commandReview:
+		return r.printReviews(w)
+	case commandMetrics:
+		return r.printMetrics(w)
+	case commandReport:
+		return r.printReport(w)
+	case commandGraph, commandWhoCan:
+		return r.writeGraph(w)
 	}
-	return config
+	return nil
 }
 
 const (
@@ -101,7 +147,9 @@ const (
 	kindClusterRole        = "clusterrole"
 	kindUser               = "user"
 	kindGroup              = "group"
-	kindRule               = "rule" // internal kind used for nodes that list access rules defined in a role
+	kindSecret             = "secret"    // internal kind used for Secrets referenced by ServiceAccounts
+	kindRule               = "rule"      // internal kind used for nodes that list access rules defined in a role
+	kindNamespace          = "namespace" // internal kind used for nodes summarizing a collapsed namespace
 )
 
 var kindMap = map[string]string{
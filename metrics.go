@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// metric is a gauge in the Prometheus text exposition format
+type metric struct {
+	name, help string
+	labels     []string           // the names of the labels
+	values     map[string]float64 // by the label values, joined with "\x00"
+}
+
+func newMetric(name, help string, labels ...string) *metric {
+	return &metric{name: "rback_" + name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+func (m *metric) add(value float64, labelValues ...string) {
+	m.values[strings.Join(labelValues, "\x00")] += value
+}
+
+func (m *metric) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+	keys := []string{}
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		labels := []string{}
+		for i, value := range strings.Split(key, "\x00") {
+			if i < len(m.labels) {
+				labels = append(labels, fmt.Sprintf("%s=%q", m.labels[i], value))
+			}
+		}
+		if len(labels) > 0 {
+			fmt.Fprintf(w, "%s{%s} %v\n", m.name, strings.Join(labels, ","), m.values[key])
+		} else {
+			fmt.Fprintf(w, "%s %v\n", m.name, m.values[key])
+		}
+	}
+}
+
+// metrics returns gauges describing the RBAC posture: the number of objects, cluster-admin-equivalent subjects,
+// wildcard rules, bindings referencing missing roles or ServiceAccounts, and ServiceAccounts that can read Secrets
+func (r *Rback) metrics() []*metric {
+	serviceAccounts := newMetric("service_accounts", "Number of ServiceAccounts.", "namespace")
+	roles := newMetric("roles", "Number of Roles (and ClusterRoles, with an empty namespace).", "kind", "namespace")
+	bindings := newMetric("bindings", "Number of RoleBindings (and ClusterRoleBindings, with an empty namespace).", "kind", "namespace")
+	wildcardRules := newMetric("wildcard_rules", "Number of rules with a wildcard in their verbs, resources or API groups.", "kind", "namespace")
+	missingRoles := newMetric("bindings_with_missing_role", "Number of bindings referencing a (Cluster)Role that doesn't exist.", "kind", "namespace")
+	missingSubjects := newMetric("missing_service_account_subjects", "Number of ServiceAccounts referenced by bindings that don't exist.", "namespace")
+	clusterAdmins := newMetric("cluster_admin_equivalent_subjects", "Number of subjects allowed to do anything cluster-wide.")
+	clusterAdmin := newMetric("cluster_admin_equivalent_subject", "Subjects allowed to do anything cluster-wide.", "subject_kind", "subject_namespace", "subject")
+	secretReaders := newMetric("service_accounts_with_secret_read_access", "Number of ServiceAccounts allowed to get, list or watch Secrets (in any namespace).", "namespace")
+
+	for ns, sas := range r.permissions.ServiceAccounts {
+		if r.namespaceSelected(ns) {
+			serviceAccounts.add(float64(len(sas)), ns)
+		}
+	}
+	for ns, nsRoles := range r.permissions.Roles {
+		if ns != "" && !r.namespaceSelected(ns) {
+			continue
+		}
+		kind := iff(ns == "", "ClusterRole", "Role")
+		roles.add(float64(len(nsRoles)), kind, ns)
+		for _, role := range nsRoles {
+			for _, rule := range role.rules {
+				if contains(rule.verbs, "*") || contains(rule.resources, "*") || contains(rule.apiGroups, "*") || contains(rule.nonResourceURLs, "*") {
+					wildcardRules.add(1, kind, ns)
+				}
+			}
+		}
+	}
+
+	admins := map[KindNamespacedName]bool{}
+	missingSAs := map[KindNamespacedName]bool{}
+	for ns, nsBindings := range r.permissions.RoleBindings {
+		if ns != "" && !r.namespaceSelected(ns) {
+			continue
+		}
+		kind := iff(ns == "", "ClusterRoleBinding", "RoleBinding")
+		bindings.add(float64(len(nsBindings)), kind, ns)
+		for _, binding := range nsBindings {
+			role, found := r.permissions.Roles[binding.role.namespace][binding.role.name]
+			if !found {
+				missingRoles.add(1, kind, ns)
+			}
+			for _, subject := range binding.subjects {
+				if !r.subjectExists(subject.kind, subject.namespace, subject.name) {
+					missingSAs[subject] = true
+				}
+				if found && ns == "" && allowsEverything(role) {
+					admins[subject] = true
+				}
+			}
+		}
+	}
+	for subject := range missingSAs {
+		missingSubjects.add(1, subject.namespace)
+	}
+	for ns, sas := range r.permissions.ServiceAccounts {
+		for name := range sas {
+			sa := KindNamespacedName{"ServiceAccount", NamespacedName{ns, name}}
+			for _, grant := range r.effectiveGrantsFor(sa, nil) {
+				if grant.scope() == "" && allowsEverything(grant.role) {
+					admins[sa] = true // through a group, e.g. system:serviceaccounts
+				}
+			}
+		}
+	}
+	clusterAdmins.add(float64(len(admins)))
+	for subject := range admins {
+		clusterAdmin.add(1, subject.kind, subject.namespace, subject.name)
+	}
+
+	for ns, sas := range r.permissions.ServiceAccounts {
+		if !r.namespaceSelected(ns) {
+			continue
+		}
+		for name := range sas {
+			if r.canReadSecrets(KindNamespacedName{"ServiceAccount", NamespacedName{ns, name}}) {
+				secretReaders.add(1, ns)
+			}
+		}
+	}
+
+	return []*metric{serviceAccounts, roles, bindings, wildcardRules, missingRoles, missingSubjects, clusterAdmins, clusterAdmin, secretReaders}
+}
+
+// allowsEverything returns true if the role has a rule allowing all verbs on all resources of all API groups
+func allowsEverything(role Role) bool {
+	for _, rule := range role.rules {
+		if contains(rule.verbs, "*") && contains(rule.resources, "*") && contains(rule.apiGroups, "*") && len(rule.resourceNames) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// canReadSecrets returns true if the subject is granted (directly or through the groups it's implicitly a member of)
+// to get, list or watch Secrets
+func (r *Rback) canReadSecrets(subject KindNamespacedName) bool {
+	coreGroup := ""
+	for _, grant := range r.effectiveGrantsFor(subject, nil) {
+		for _, verb := range []string{"get", "list", "watch"} {
+			whoCan := WhoCan{verb: verb, resourceKind: "secrets", apiGroup: &coreGroup}
+			if whoCan.matchesAnyRuleIn(grant.role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printMetrics prints the metrics in the Prometheus text exposition format
+func (r *Rback) printMetrics(w io.Writer) error {
+	for _, m := range r.metrics() {
+		m.write(w)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// output formats of the commands rendering graphs
+const (
+	outputDot       = "dot"
+	outputTree      = "tree"
+	outputCypher    = "cypher"
+	outputCypherCSV = "cypher-csv" // writes a directory, so only supported with --output-file
+	outputGraphML   = "graphml"
+	outputGEXF      = "gexf"
+	outputPlantUML  = "plantuml"
+)
+
+var graphOutputFormats = []string{outputDot, outputTree, outputCypher, outputCypherCSV, outputGraphML, outputGEXF, outputPlantUML}
+
+// writeGraph writes the graph in the configured output format
+func (r *Rback) writeGraph(w io.Writer) error {
+	switch r.config.outputFormat {
+	case "", outputDot:
+		_, err := fmt.Fprintln(w, r.genGraph().String())
+		return err
+	case outputTree:
+		return r.writeTree(w)
+	case outputCypher:
+		return r.writeCypher(w)
+	case outputCypherCSV:
+		return fmt.Errorf("--output %s writes a directory and thus requires --output-file", outputCypherCSV)
+	case outputGraphML:
+		return r.writeGraphML(w)
+	case outputGEXF:
+		return r.writeGEXF(w)
+	case outputPlantUML:
+		return r.writePlantUML(w)
+	}
+	return fmt.Errorf("Unsupported output format %q (supported: %s)", r.config.outputFormat, strings.Join(graphOutputFormats, ", "))
+}
@@ -25,6 +25,9 @@ func (r *Rback) parseRBAC(reader io.Reader) (err error) {
 	r.permissions.ServiceAccounts = make(map[string]map[string]string)
 	r.permissions.Roles = make(map[string]map[string]Role)
 	r.permissions.RoleBindings = make(map[string]map[string]Binding)
+	r.permissions.Workloads = make(map[string][]Workload)
+	r.permissions.Namespaces = make(map[string]Namespace)
+	r.permissions.Secrets = make(map[string]map[string]Secret)
 
 	items := input["items"].([]interface{})
 	for _, i := range items {
@@ -54,6 +57,15 @@ func (r *Rback) parseRBAC(reader io.Reader) (err error) {
 				r.permissions.Roles[nn.namespace] = make(map[string]Role)
 			}
 			r.permissions.Roles[nn.namespace][nn.name] = toRole(item)
+		case "Namespace":
+			r.permissions.Namespaces[nn.name] = toNamespace(item)
+		case "Secret":
+			if r.permissions.Secrets[nn.namespace] == nil {
+				r.permissions.Secrets[nn.namespace] = make(map[string]Secret)
+			}
+			r.permissions.Secrets[nn.namespace][nn.name] = toSecret(item)
+		case "Pod", "ReplicaSet", "Deployment", "StatefulSet", "DaemonSet", "Job", "CronJob":
+			r.permissions.Workloads[nn.namespace] = append(r.permissions.Workloads[nn.namespace], toWorkload(item))
 		default:
 			log.Printf("Ignoring resource kind %s", kind)
 		}
@@ -97,25 +109,111 @@ func toRole(rawRole map[string]interface{}) Role {
 		rules = append(rules, toRule(r))
 	}
 
+	metadata := getMetadata(rawRole)
 	return Role{
-		getNamespacedName(getMetadata(rawRole)),
+		getNamespacedName(metadata),
 		rules,
+		toObjectMeta(metadata),
+	}
+}
+
+func toNamespace(rawNamespace map[string]interface{}) Namespace {
+	metadata := getMetadata(rawNamespace)
+	namespace := Namespace{
+		name:       metadata["name"].(string),
+		ObjectMeta: toObjectMeta(metadata),
+		phase:      "Active",
+	}
+	if status, found := rawNamespace["status"].(map[string]interface{}); found && status["phase"] != nil {
+		namespace.phase = status["phase"].(string)
+	}
+	return namespace
+}
+
+func toSecret(rawSecret map[string]interface{}) Secret {
+	metadata := getMetadata(rawSecret)
+	meta := toObjectMeta(metadata)
+	return Secret{
+		NamespacedName:     getNamespacedName(metadata),
+		secretType:         stringOrEmpty(rawSecret["type"]),
+		serviceAccountName: meta.annotations["kubernetes.io/service-account.name"],
+		ObjectMeta:         meta,
+	}
+}
+
+func toWorkload(rawWorkload map[string]interface{}) Workload {
+	metadata := getMetadata(rawWorkload)
+	workload := Workload{
+		kind:           rawWorkload["kind"].(string),
+		NamespacedName: getNamespacedName(metadata),
+		ObjectMeta:     toObjectMeta(metadata),
+	}
+
+	podSpec := getPodSpec(rawWorkload)
+	workload.serviceAccountName = stringOrEmpty(podSpec["serviceAccountName"])
+	if workload.serviceAccountName == "" {
+		workload.serviceAccountName = stringOrEmpty(podSpec["serviceAccount"]) // deprecated alias of serviceAccountName
+	}
+	if workload.serviceAccountName == "" {
+		workload.serviceAccountName = "default"
 	}
+	if automount, found := podSpec["automountServiceAccountToken"].(bool); found {
+		workload.automountServiceAccountToken = &automount
+	}
+
+	ownerReferences, _ := metadata["ownerReferences"].([]interface{})
+	for _, o := range ownerReferences {
+		owner, _ := o.(map[string]interface{})
+		if owner["controller"] == true {
+			workload.controller = &KindNamespacedName{
+				kind:           stringOrEmpty(owner["kind"]),
+				NamespacedName: NamespacedName{workload.namespace, stringOrEmpty(owner["name"])},
+			}
+		}
+	}
+	return workload
+}
+
+// getPodSpec returns the spec of the pod (template) of the given Pod or controller
+func getPodSpec(rawWorkload map[string]interface{}) map[string]interface{} {
+	var path []string
+	switch rawWorkload["kind"] {
+	case "Pod":
+		path = []string{"spec"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		path = []string{"spec", "template", "spec"}
+	}
+
+	obj := rawWorkload
+	for _, field := range path {
+		child, found := obj[field].(map[string]interface{})
+		if !found {
+			return map[string]interface{}{}
+		}
+		obj = child
+	}
+	return obj
 }
 
 func (r *Rback) toBinding(rawBinding map[string]interface{}) Binding {
 	subjects := []KindNamespacedName{}
+	ignoredSubjects := 0
 	if rawBinding["subjects"] != nil {
 		rawSubjects := rawBinding["subjects"].([]interface{})
 		for _, s := range rawSubjects {
 			subject := toKindNamespacedName(s)
-			if !r.shouldIgnore(subject.name) {
+			if r.shouldIgnore(subject.name) {
+				ignoredSubjects++
+			} else {
 				subjects = append(subjects, subject)
 			}
 		}
 	}
 
-	bindingNn := getNamespacedName(getMetadata(rawBinding))
+	bindingMetadata := getMetadata(rawBinding)
+	bindingNn := getNamespacedName(bindingMetadata)
 
 	roleRef := rawBinding["roleRef"].(map[string]interface{})
 	role := getNamespacedName(roleRef) // note: namespace is always "", since there is no namespace field in roleRef
@@ -123,17 +221,27 @@ func (r *Rback) toBinding(rawBinding map[string]interface{}) Binding {
 		role.namespace = bindingNn.namespace
 	}
 	return Binding{
-		NamespacedName: bindingNn,
-		role:           role,
-		subjects:       subjects,
+		NamespacedName:  bindingNn,
+		role:            role,
+		subjects:        subjects,
+		ignoredSubjects: ignoredSubjects,
+		ObjectMeta:      toObjectMeta(bindingMetadata),
 	}
 }
 
-func stringOrEmpty(i interface{}) string {
-	if i == nil {
-		return ""
+func toObjectMeta(metadata map[string]interface{}) ObjectMeta {
+	created, _ := metadata["creationTimestamp"].(string)
+	return ObjectMeta{
+		labels:      toStringMap(metadata["labels"]),
+		annotations: toStringMap(metadata["annotations"]),
+		created:     created,
 	}
-	return i.(string)
+}
+
+// stringOrEmpty returns the value if it's a string, or "" (e.g. if it's missing)
+func stringOrEmpty(i interface{}) string {
+	s, _ := i.(string)
+	return s
 }
 
 func toRule(rule interface{}) Rule {
@@ -158,6 +266,78 @@ func toStringArray(values interface{}) []string {
 	return strs
 }
 
+func toStringMap(values interface{}) map[string]string {
+	result := map[string]string{}
+	if values == nil {
+		return result
+	}
+	for k, v := range values.(map[string]interface{}) {
+		result[k] = stringOrEmpty(v)
+	}
+	return result
+}
+
+// serviceAccount returns the ServiceAccount object, as stored by parseRBAC
+func (r *Rback) serviceAccount(ns, name string) (map[string]interface{}, bool) {
+	sa, found := r.permissions.ServiceAccounts[ns][name]
+	if !found {
+		return nil, false
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(sa), &obj); err != nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+func (r *Rback) serviceAccountLabels(ns, name string) map[string]string {
+	if sa, found := r.serviceAccount(ns, name); found {
+		return toStringMap(getMetadata(sa)["labels"])
+	}
+	return map[string]string{}
+}
+
+// serviceAccountSecrets returns the names of the Secrets and the image pull Secrets referenced by the ServiceAccount
+func (r *Rback) serviceAccountSecrets(ns, name string) (secrets []string, imagePullSecrets []string) {
+	sa, found := r.serviceAccount(ns, name)
+	if !found {
+		return nil, nil
+	}
+	return toSecretNames(sa["secrets"]), toSecretNames(sa["imagePullSecrets"])
+}
+
+func toSecretNames(references interface{}) []string {
+	names := []string{}
+	if references == nil {
+		return names
+	}
+	for _, ref := range references.([]interface{}) {
+		if name := stringOrEmpty(ref.(map[string]interface{})["name"]); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// serviceAccountAutomountsToken returns false only if the ServiceAccount explicitly disables automounting its token
+func (r *Rback) serviceAccountAutomountsToken(ns, name string) bool {
+	if sa, found := r.serviceAccount(ns, name); found {
+		if automount, found := sa["automountServiceAccountToken"].(bool); found {
+			return automount
+		}
+	}
+	return true
+}
+
+// workloadAutomountsToken returns whether the token of the workload's ServiceAccount is mounted into its pods: the pod
+// spec's automountServiceAccountToken takes precedence, if it's not set the ServiceAccount's setting applies
+func (r *Rback) workloadAutomountsToken(workload Workload) bool {
+	if workload.automountServiceAccountToken != nil {
+		return *workload.automountServiceAccountToken
+	}
+	return r.serviceAccountAutomountsToken(workload.namespace, workload.serviceAccountName)
+}
+
 // struct2json turns a map into a JSON string
 func struct2json(s map[string]interface{}) (string, error) {
 	str, err := json.Marshal(s)
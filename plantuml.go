@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// writePlantUML writes the drawn graph as a PlantUML component diagram: namespaces are packages, subjects,
+// bindings, roles and workloads are components, and the rules of roles are notes. Missing and highlighted objects
+// are styled like in the DOT output, using the theme's colors.
+func (r *Rback) writePlantUML(w io.Writer) error {
+	r.genGraph()
+	theme := r.config.theme
+
+	ids := r.sortedRenderedNodeIDs()
+	aliases := map[string]string{}
+	byNamespace := map[string][]string{}
+	for i, id := range ids {
+		aliases[id] = fmt.Sprintf("n%d", i+1)
+		ns := r.renderedNodes[id].namespace
+		byNamespace[ns] = append(byNamespace[ns], id)
+	}
+	namespaces := []string{}
+	for ns := range byNamespace {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	fmt.Fprintln(w, "@startuml")
+	if theme.RankDir == "LR" {
+		fmt.Fprintln(w, "left to right direction")
+	}
+	if theme.Background != "" {
+		fmt.Fprintf(w, "skinparam backgroundColor %s\n", plantUMLColor(theme.Background))
+	}
+	if theme.EdgeColor != "" {
+		fmt.Fprintf(w, "skinparam arrowColor %s\n", plantUMLColor(theme.EdgeColor))
+	}
+	if theme.FontColor != "" {
+		fmt.Fprintf(w, "skinparam packageFontColor %s\n", plantUMLColor(theme.FontColor))
+	}
+
+	for _, ns := range namespaces {
+		indent := ""
+		if ns != "" {
+			phase := r.namespacePhase(ns)
+			style := theme.Namespace
+			switch phase {
+			case phaseMissing:
+				style = style.merge(theme.MissingNamespace)
+			case phaseTerminating:
+				style = style.merge(theme.TerminatingNamespace)
+			}
+			declaration := fmt.Sprintf(`package "%s"`, plantUMLEscape(ns))
+			if phase == phaseMissing || phase == phaseTerminating {
+				declaration += " <<" + phase + ">>"
+				style.Style = iff(phase == phaseMissing, "dashed", style.Style)
+			}
+			fmt.Fprintf(w, "%s {\n", withPlantUMLStyle(declaration, style))
+			indent = "  "
+		}
+		for _, id := range byNamespace[ns] {
+			r.writePlantUMLNode(w, indent, id, aliases[id])
+		}
+		if ns != "" {
+			fmt.Fprintln(w, "}")
+		}
+	}
+
+	for _, edge := range r.sortedRenderedEdges() {
+		from, to := aliases[edge.from], aliases[edge.to]
+		switch edge.edgeType {
+		case edgeBoundBy:
+			fmt.Fprintf(w, "%s <-- %s\n", from, to) // like in the DOT output, the arrow points to the subject
+		case edgeHasRules:
+			fmt.Fprintf(w, "%s .. %s\n", from, to)
+		case edgeImagePullSecret:
+			fmt.Fprintf(w, "%s ..> %s : image pull\n", from, to)
+		case edgeRunsAs:
+			if !r.automountsToken(r.renderedNodes[edge.from]) {
+				fmt.Fprintf(w, "%s ..> %s\n", from, to)
+			} else {
+				fmt.Fprintf(w, "%s --> %s\n", from, to)
+			}
+		default:
+			fmt.Fprintf(w, "%s --> %s\n", from, to)
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "@enduml")
+	return err
+}
+
+func (r *Rback) writePlantUMLNode(w io.Writer, indent, id, alias string) {
+	node := r.renderedNodes[id]
+	theme := r.config.theme
+	if node.kind == kindRule {
+		fmt.Fprintf(w, "%s%s\n", indent, withPlantUMLStyle("note as "+alias, theme.nodeStyle(themeRules, true, node.focused)))
+		for _, rule := range r.renderedRules(id, node) {
+			line := plantUMLEscape(rule.text)
+			if rule.matches {
+				line = "**" + line + "**"
+			}
+			fmt.Fprintf(w, "%s  %s\n", indent, line)
+		}
+		fmt.Fprintf(w, "%send note\n", indent)
+		return
+	}
+
+	label := plantUMLEscape(node.name)
+	if node.focused {
+		label = "**" + label + "**"
+	}
+	element, themeKind, stereotype := "component", themeSubject, node.title()
+	switch {
+	case node.kind == kindRoleBinding:
+		themeKind = themeRoleBinding
+	case node.kind == kindClusterRoleBinding:
+		themeKind = themeClusterRoleBinding
+	case node.kind == kindRole:
+		themeKind = themeRole
+	case node.kind == kindClusterRole:
+		themeKind = themeClusterRole
+	case node.kind == kindSecret:
+		element, themeKind = "database", themeSecret
+	case node.kind == kindNamespace:
+		element, themeKind = "folder", themeNamespaceSummary
+	case strings.HasPrefix(node.kind, "collapsed-"):
+	case node.kind != kindServiceAccount && node.kind != kindUser && node.kind != kindGroup:
+		themeKind = themeWorkload
+	}
+	if !node.exists {
+		stereotype += ", missing"
+	}
+	style := theme.nodeStyle(themeKind, node.exists, node.focused)
+	if node.kind == kindClusterRole && node.namespace != "" && node.exists {
+		style.Style = "dashed" // like in the DOT output, ClusterRoles bound by RoleBindings are dashed
+	}
+	fmt.Fprintf(w, "%s%s\n", indent, withPlantUMLStyle(fmt.Sprintf(`%s "%s" as %s <<%s>>`, element, label, alias, stereotype), style))
+}
+
+// automountsToken returns whether the workload drawn as the node automounts its ServiceAccount's token
+func (r *Rback) automountsToken(node renderedNode) bool {
+	for _, workload := range r.permissions.Workloads[node.namespace] {
+		if strings.ToLower(workload.kind) == node.kind && workload.name == node.name {
+			return r.workloadAutomountsToken(workload)
+		}
+	}
+	return true
+}
+
+func withPlantUMLStyle(declaration string, style NodeStyle) string {
+	if inline := plantUMLStyle(style); inline != "" {
+		return declaration + " " + inline
+	}
+	return declaration
+}
+
+// plantUMLStyle returns the inline style of an element, e.g. "#ff9900;line:black;line.dotted;line.bold;text:030303"
+// (the fill color is optional)
+func plantUMLStyle(style NodeStyle) string {
+	parts := []string{}
+	if style.FillColor != "" {
+		parts = append(parts, strings.TrimPrefix(style.FillColor, "#"))
+	}
+	if style.Color != "" {
+		parts = append(parts, "line:"+strings.TrimPrefix(style.Color, "#"))
+	}
+	if strings.Contains(style.Style, "dashed") {
+		parts = append(parts, "line.dashed")
+	} else if strings.Contains(style.Style, "dotted") {
+		parts = append(parts, "line.dotted")
+	}
+	if style.PenWidth != "" && style.PenWidth != "1.0" && style.PenWidth != "1" {
+		parts = append(parts, "line.bold")
+	}
+	if style.FontColor != "" {
+		parts = append(parts, "text:"+strings.TrimPrefix(style.FontColor, "#"))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "#" + strings.Join(parts, ";")
+}
+
+// plantUMLColor returns the color as PlantUML expects it, i.e. with a # in front of names and hex values
+func plantUMLColor(color string) string {
+	return "#" + strings.TrimPrefix(color, "#")
+}
+
+// plantUMLEscape escapes the characters PlantUML's creole markup would interpret, e.g. "*" (bold or list items), and
+// replaces double quotes, which can't be escaped in names
+func plantUMLEscape(text string) string {
+	return strings.NewReplacer(`~`, `~~`, `*`, `~*`, `__`, `~_~_`, `--`, `~-~-`, `//`, `~/~/`, `"`, `'`).Replace(text)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Policy is a set of RBAC invariants, e.g.:
+//
+//	assertions:
+//	- name: only ops may create secrets in prod
+//	  verb: create
+//	  resource: secrets
+//	  namespace: prod
+//	  allowed:
+//	  - {kind: Group, name: ops}
+//	- name: no ServiceAccount in default may list anything cluster-wide
+//	  verb: list
+//	  clusterWide: true
+//	  forbidden:
+//	  - {kind: ServiceAccount, namespace: default}
+//	- name: nobody but admins is bound to cluster-admin
+//	  clusterRole: cluster-admin
+//	  allowed:
+//	  - {kind: Group, name: admins}
+type Policy struct {
+	Assertions []Assertion `yaml:"assertions"`
+}
+
+// Assertion restricts who may be granted a permission (verb + resource) or be bound to a (Cluster)Role.
+// Subjects matching forbidden (or, if allowed is set, subjects not matching allowed) are violations.
+// If neither allowed nor forbidden is set, nobody may be granted the permission or role.
+type Assertion struct {
+	Name string `yaml:"name"`
+
+	Verb         string `yaml:"verb"`
+	Resource     string `yaml:"resource"`     // any resource, if empty
+	ResourceName string `yaml:"resourceName"` // any resource name, if empty
+	Namespace    string `yaml:"namespace"`    // any namespace, if empty
+	ClusterWide  bool   `yaml:"clusterWide"`  // only consider permissions granted through ClusterRoleBindings
+
+	ClusterRole string `yaml:"clusterRole"`
+	Role        string `yaml:"role"` // NAMESPACE/NAME
+
+	Allowed   []SubjectMatcher `yaml:"allowed"`
+	Forbidden []SubjectMatcher `yaml:"forbidden"`
+}
+
+// SubjectMatcher matches subjects; empty fields match anything
+type SubjectMatcher struct {
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+type Violation struct {
+	Assertion string `json:"assertion"`
+	Subject   string `json:"subject"`
+	Binding   string `json:"binding"`
+	Role      string `json:"role"`
+	Rule      string `json:"rule,omitempty"`
+}
+
+func loadPolicy(file string) (Policy, error) {
+	var policy Policy
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return policy, fmt.Errorf("Can't read policy %s: %v", file, err)
+	}
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return policy, fmt.Errorf("Can't parse policy %s: %v", file, err)
+	}
+	for i, a := range policy.Assertions {
+		hasPermission := a.Verb != ""
+		hasRole := a.ClusterRole != "" || a.Role != ""
+		if hasPermission == hasRole {
+			return policy, fmt.Errorf("Assertion %d (%s) must specify either a verb or a (cluster)role", i+1, a.Name)
+		}
+		if a.Role != "" && !strings.Contains(a.Role, "/") {
+			return policy, fmt.Errorf("Assertion %d (%s): role must be specified as NAMESPACE/NAME", i+1, a.Name)
+		}
+	}
+	return policy, nil
+}
+
+// checkPolicy evaluates all assertions against all bindings and returns the violations
+func (r *Rback) checkPolicy(policy Policy) []Violation {
+	violations := []Violation{}
+	for _, assertion := range policy.Assertions {
+		for _, bindings := range r.permissions.RoleBindings {
+			for _, binding := range bindings {
+				rules, granted := r.bindingGrants(assertion, binding)
+				if !granted {
+					continue
+				}
+				for _, subject := range binding.subjects {
+					if !assertion.forbids(subject) {
+						continue
+					}
+					violation := Violation{
+						Assertion: assertion.Name,
+						Subject:   subjectString(subject),
+						Binding:   bindingString(binding),
+						Role:      roleString(binding.role),
+					}
+					for _, rule := range rules {
+						violation.Rule = rule.toHumanReadableString()
+						violations = append(violations, violation)
+					}
+					if len(rules) == 0 {
+						violations = append(violations, violation)
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		a, b := violations[i], violations[j]
+		return a.Assertion < b.Assertion || (a.Assertion == b.Assertion && a.Subject < b.Subject)
+	})
+	return violations
+}
+
+// bindingGrants returns whether the binding grants what the assertion restricts, along with the matching rules (if
+// the assertion is about a permission)
+func (r *Rback) bindingGrants(assertion Assertion, binding Binding) ([]Rule, bool) {
+	if assertion.ClusterRole != "" {
+		return nil, binding.role.namespace == "" && binding.role.name == assertion.ClusterRole
+	}
+	if assertion.Role != "" {
+		return nil, qualifiedName(binding.role.namespace, binding.role.name) == assertion.Role
+	}
+
+	if assertion.ClusterWide && binding.namespace != "" {
+		return nil, false
+	}
+	if assertion.Namespace != "" && binding.namespace != "" && binding.namespace != assertion.Namespace {
+		return nil, false
+	}
+
+	role, found := r.permissions.Roles[binding.role.namespace][binding.role.name]
+	if !found {
+		return nil, false
+	}
+	whoCan := WhoCan{verb: assertion.Verb, resourceKind: assertion.Resource, resourceName: assertion.ResourceName}
+	matchingRules := []Rule{}
+	for _, rule := range role.rules {
+		anyResource := assertion.Resource == "" && len(rule.resources) > 0 && matchesValueOrWildcard(rule.verbs, assertion.Verb)
+		if anyResource || whoCan.matches(rule) {
+			matchingRules = append(matchingRules, rule)
+		}
+	}
+	return matchingRules, len(matchingRules) > 0
+}
+
+// forbids returns true if the subject violates the assertion; a group forbidden subjects are implicitly members of
+// (e.g. system:serviceaccounts:default for ServiceAccounts in default) is forbidden as well
+func (a Assertion) forbids(subject KindNamespacedName) bool {
+	for _, m := range a.Forbidden {
+		if m.matches(subject) || (subject.kind == "Group" && m.matchesMemberOf(subject.name)) {
+			return true
+		}
+	}
+	if len(a.Allowed) > 0 {
+		for _, m := range a.Allowed {
+			if m.matches(subject) {
+				return false
+			}
+		}
+		return true
+	}
+	return len(a.Forbidden) == 0
+}
+
+func (m SubjectMatcher) matches(subject KindNamespacedName) bool {
+	return (m.Kind == "" || strings.EqualFold(m.Kind, subject.kind)) &&
+		(m.Name == "" || m.Name == subject.name) &&
+		(m.Namespace == "" || m.Namespace == subject.namespace)
+}
+
+// matchesMemberOf returns true if the matcher matches any of the subjects Kubernetes puts into the group implicitly:
+// all ServiceAccounts (of the namespace) for system:serviceaccounts[:NAMESPACE], and all ServiceAccounts and Users
+// for system:authenticated
+func (m SubjectMatcher) matchesMemberOf(group string) bool {
+	serviceAccounts := m.Kind == "" || strings.EqualFold(m.Kind, "ServiceAccount")
+	switch {
+	case group == groupAuthenticated:
+		return serviceAccounts || strings.EqualFold(m.Kind, "User")
+	case group == groupServiceAccounts:
+		return serviceAccounts
+	case strings.HasPrefix(group, groupServiceAccounts+":"):
+		return serviceAccounts && (m.Namespace == "" || m.Namespace == strings.TrimPrefix(group, groupServiceAccounts+":"))
+	}
+	return false
+}
+
+func bindingString(binding Binding) string {
+	if binding.namespace == "" {
+		return "ClusterRoleBinding " + binding.name
+	}
+	return "RoleBinding " + qualifiedName(binding.namespace, binding.name)
+}
+
+func roleString(role NamespacedName) string {
+	if role.namespace == "" {
+		return "ClusterRole " + role.name
+	}
+	return "Role " + qualifiedName(role.namespace, role.name)
+}
+
+// printPolicyViolations checks the policy and prints all violations; it returns an error if there were any
+func (r *Rback) printPolicyViolations(w io.Writer) error {
+	policy, err := loadPolicy(r.config.policyFile)
+	if err != nil {
+		return err
+	}
+
+	violations := r.checkPolicy(policy)
+	switch r.config.outputFormat {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(violations); err != nil {
+			return err
+		}
+	case "", "text":
+		for _, v := range violations {
+			chain := []string{v.Subject, v.Binding, v.Role}
+			if v.Rule != "" {
+				chain = append(chain, v.Rule)
+			}
+			fmt.Fprintf(w, "VIOLATION %s: %s\n", v.Assertion, strings.Join(chain, " -> "))
+		}
+	default:
+		return fmt.Errorf("Unsupported output format %q (supported: text, json)", r.config.outputFormat)
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("%d policy violation(s) found", len(violations))
+	}
+	return nil
+}
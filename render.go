@@ -2,42 +2,105 @@ package main
 
 import (
 	"fmt"
+	"path"
 	"strings"
 
 	"github.com/emicklei/dot"
 )
 
 func (r *Rback) genGraph() *dot.Graph {
-	g := newGraph()
+	r.collapsedNamespaces = map[string]bool{}
+	if r.config.summary {
+		for _, ns := range r.allNamespaceNames() {
+			r.collapsedNamespaces[ns] = !r.namespaceContainsFocus(ns)
+		}
+	}
+
+	g := r.genGraph0()
+	if r.config.maxNodes > 0 {
+		g = r.fitIntoNodeBudget(g)
+	}
+	return g
+}
+
+// genGraph0 draws the graph with the current collapse settings
+func (r *Rback) genGraph0() *dot.Graph {
+	g := r.newGraph()
 	r.renderLegend(g)
+	r.renderedNodes = map[string]renderedNode{}
+	r.renderedEdges = map[renderedEdge]bool{}
+
+	saNodes := map[NamespacedName]graphNode{} // all ServiceAccount nodes drawn so far; used to attach workloads
+	bindingsToRender := r.bindingsToRender()
 
 	for _, bindings := range r.permissions.RoleBindings {
 		for _, binding := range bindings {
-			if !r.shouldRenderBinding(binding) {
+			if !bindingsToRender[binding.NamespacedName] {
 				continue
 			}
 
-			gns := newNamespaceSubgraph(g, binding.namespace)
+			gns := g
+			bindingCollapsed := r.collapsedNamespaces[binding.namespace]
 
-			bindingNode := r.newBindingNode(gns, binding)
-			roleNode := r.newRoleAndRulesNodePair(gns, binding.namespace, binding.role)
+			var bindingNode, roleNode graphNode
+			if bindingCollapsed {
+				bindingNode = r.newNamespaceSummaryNode(g, binding.namespace)
+			} else {
+				gns = r.newNamespaceSubgraph(g, binding.namespace)
+				bindingNode = r.newBindingNode(gns, binding)
+			}
 
-			newBindingToRoleEdge(bindingNode, roleNode)
+			if binding.role.namespace != "" && r.collapsedNamespaces[binding.role.namespace] {
+				roleNode = r.newNamespaceSummaryNode(g, binding.role.namespace)
+			} else if bindingCollapsed {
+				roleNode = r.newRoleAndRulesNodePair(g, "", binding.role) // a ClusterRole, so draw it outside of the collapsed namespace
+			} else {
+				roleNode = r.newRoleAndRulesNodePair(gns, binding.namespace, binding.role)
+			}
+			if !bindingCollapsed || binding.role.namespace != binding.namespace {
+				r.newBindingToRoleEdge(bindingNode.Node, roleNode.Node)
+				r.recordEdge(bindingNode, roleNode, edgeGrants)
+			}
 
-			saNodes := []dot.Node{}
+			subjectNodes := []graphNode{}
+			subjectsToCollapse := map[string][]KindNamespacedName{} // by kind
 			for _, subject := range binding.subjects {
-				renderSubject := (r.config.resourceKind != kindServiceAccount) ||
+				renderSubject := (r.config.resourceKind != kindServiceAccount) || r.config.depth > 1 ||
 					(r.namespaceSelected(subject.namespace) && r.resourceNameSelected(subject.name))
+				if !renderSubject {
+					continue
+				}
 
-				if renderSubject {
-					gns := newNamespaceSubgraph(g, subject.namespace)
-					subjectNode := r.newSubjectNode(gns, subject.kind, subject.namespace, subject.name)
-					saNodes = append(saNodes, subjectNode)
+				if subject.kind == "ServiceAccount" && r.collapsedNamespaces[subject.namespace] {
+					if !bindingCollapsed || subject.namespace != binding.namespace {
+						subjectNodes = append(subjectNodes, r.newNamespaceSummaryNode(g, subject.namespace))
+					}
+				} else if !r.isFocused(strings.ToLower(subject.kind), subject.namespace, subject.name) {
+					subjectsToCollapse[subject.kind] = append(subjectsToCollapse[subject.kind], subject)
+				} else {
+					subjectNodes = append(subjectNodes, r.newSubjectNodeForBinding(g, subject, saNodes))
 				}
 			}
 
-			for _, saNode := range saNodes {
-				newSubjectToBindingEdge(saNode, bindingNode)
+			for kind, subjects := range subjectsToCollapse {
+				if r.config.collapseSubjects > 0 && len(subjects) > r.config.collapseSubjects {
+					collapsedNode := r.newCollapsedSubjectsNode(gns, binding, kind, subjects)
+					subjectNodes = append(subjectNodes, collapsedNode)
+					for _, subject := range subjects {
+						if subject.kind == "ServiceAccount" {
+							saNodes[subject.NamespacedName] = collapsedNode
+						}
+					}
+				} else {
+					for _, subject := range subjects {
+						subjectNodes = append(subjectNodes, r.newSubjectNodeForBinding(g, subject, saNodes))
+					}
+				}
+			}
+
+			for _, subjectNode := range subjectNodes {
+				r.newSubjectToBindingEdge(subjectNode.Node, bindingNode.Node)
+				r.recordEdge(subjectNode, bindingNode, edgeBoundBy)
 			}
 		}
 	}
@@ -45,20 +108,27 @@ func (r *Rback) genGraph() *dot.Graph {
 	// draw any additional ServiceAccounts that weren't referenced by bindings (and thus drawn in the code above)
 	if r.config.resourceKind == "" || r.config.resourceKind == kindServiceAccount {
 		for ns, sas := range r.permissions.ServiceAccounts {
-			if !r.namespaceSelected(ns) {
+			if !r.namespaceSelected(ns) || r.collapsedNamespaces[ns] {
 				continue
 			}
-			gns := newNamespaceSubgraph(g, ns)
+			gns := r.newNamespaceSubgraph(g, ns)
 
 			for sa, _ := range sas {
-				renderSA := r.config.resourceKind == "" || (r.namespaceSelected(ns) && r.resourceNameSelected(sa))
+				if _, drawn := saNodes[NamespacedName{ns, sa}]; drawn {
+					continue
+				}
+				renderSA := (r.config.resourceKind == "" || (r.namespaceSelected(ns) && r.resourceNameSelected(sa))) &&
+					r.labelsSelected(r.serviceAccountLabels(ns, sa))
 				if renderSA {
-					r.newSubjectNode(gns, "ServiceAccount", ns, sa)
+					saNodes[NamespacedName{ns, sa}] = r.newSubjectNode(gns, "ServiceAccount", ns, sa)
 				}
 			}
 		}
 	}
 
+	r.renderWorkloads(g, saNodes)
+	r.renderSecrets(g, saNodes)
+
 	// draw any additional Roles that weren't referenced by bindings (and thus already drawn)
 	for ns, roles := range r.permissions.Roles {
 		var renderRoles bool
@@ -70,66 +140,221 @@ func (r *Rback) genGraph() *dot.Graph {
 			renderRoles = (r.config.resourceKind == "" || r.config.resourceKind == kindRole) && r.namespaceSelected(ns)
 		}
 
-		if !renderRoles {
+		if !renderRoles || r.collapsedNamespaces[ns] {
 			continue
 		}
 
-		gns := newNamespaceSubgraph(g, ns)
-		for roleName, _ := range roles {
-			renderRole := r.namespaceSelected(ns) && r.resourceNameSelected(roleName)
+		gns := r.newNamespaceSubgraph(g, ns)
+		for roleName, role := range roles {
+			renderRole := r.namespaceSelected(ns) && r.resourceNameSelected(roleName) && r.labelsSelected(role.labels)
 			if renderRole {
 				r.newRoleAndRulesNodePair(gns, "", NamespacedName{ns, roleName})
 			}
 		}
 	}
 
+	// draw the collapsed namespaces that weren't referenced by bindings
+	if r.config.resourceKind == "" {
+		for ns, collapsed := range r.collapsedNamespaces {
+			if collapsed && r.namespaceSelected(ns) {
+				r.newNamespaceSummaryNode(g, ns)
+			}
+		}
+	}
+
 	return g
 }
 
+// newSubjectNodeForBinding draws the subject in its namespace
+func (r *Rback) newSubjectNodeForBinding(g *dot.Graph, subject KindNamespacedName, saNodes map[NamespacedName]graphNode) graphNode {
+	gns := r.newNamespaceSubgraph(g, subject.namespace)
+	subjectNode := r.newSubjectNode(gns, subject.kind, subject.namespace, subject.name)
+	if subject.kind == "ServiceAccount" {
+		saNodes[subject.NamespacedName] = subjectNode
+	}
+	return subjectNode
+}
+
+// renderWorkloads draws the workloads running as any of the given ServiceAccounts. When the whole
+// cluster (or namespace) is rendered, workloads running as missing ServiceAccounts are drawn as well.
+func (r *Rback) renderWorkloads(g *dot.Graph, saNodes map[NamespacedName]graphNode) {
+	if !r.config.showWorkloads {
+		return
+	}
+
+	for ns, workloads := range r.permissions.Workloads {
+		for _, workload := range workloads {
+			if r.isControlledByKnownWorkload(workload) {
+				continue // the controller is drawn instead
+			}
+			if r.collapsedNamespaces[ns] {
+				continue // the workload is counted in the namespace's summary
+			}
+
+			sa := NamespacedName{ns, workload.serviceAccountName}
+			saNode, saDrawn := saNodes[sa]
+			if !saDrawn && (r.config.resourceKind != "" || r.config.selector != nil || !r.namespaceSelected(ns)) {
+				continue
+			}
+
+			gns := r.newNamespaceSubgraph(g, ns)
+			if !saDrawn {
+				saNode = r.newSubjectNode(gns, "ServiceAccount", ns, sa.name)
+				saNodes[sa] = saNode
+			}
+
+			automountToken := r.workloadAutomountsToken(workload)
+			id := nodeID(workload.kind, ns, workload.name)
+			r.recordNode(id, strings.ToLower(workload.kind), ns, workload.name, true, false)
+			workloadNode := graphNode{r.newWorkloadNode(gns, workload.kind, ns, workload.name), id}
+			r.addDetails(workloadNode.AttributesMap, workload.kind, ns, workload.name, true, workloadTooltip(workload))
+			r.newWorkloadToServiceAccountEdge(workloadNode.Node, saNode.Node, automountToken)
+			r.recordEdge(workloadNode, saNode, edgeRunsAs)
+		}
+	}
+}
+
+// isControlledByKnownWorkload returns true if the workload's controller (e.g. the Deployment of a ReplicaSet) is also in the input
+func (r *Rback) isControlledByKnownWorkload(workload Workload) bool {
+	if workload.controller == nil {
+		return false
+	}
+	for _, w := range r.permissions.Workloads[workload.namespace] {
+		if w.kind == workload.controller.kind && w.name == workload.controller.name {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Rback) renderLegend(g *dot.Graph) {
 	if !r.config.showLegend {
 		return
 	}
 
 	legend := g.Subgraph("LEGEND", dot.ClusterOption{})
+	r.config.theme.apply(r.config.theme.Namespace, legend.AttributesMap)
 
-	namespace := newNamespaceSubgraph(legend, "Namespace")
+	namespace := r.newNamespaceSubgraph0(legend, "Namespace", nil, "")
 
-	sa := newSubjectNode0(namespace, "Kind", "Subject", true, false)
-	missingSa := newSubjectNode0(namespace, "Kind", "Missing Subject", false, false)
+	sa := r.newSubjectNode0(namespace, "Kind", "ns", "Subject", "", true, false)
+	missingSa := r.newSubjectNode0(namespace, "Kind", "ns", "Missing Subject", "", false, false)
 
-	role := newRoleNode(namespace, "ns", "Role", true, false)
-	clusterRoleBoundLocally := newClusterRoleNode(namespace, "ns", "ClusterRole", true, false) // bound by (namespaced!) RoleBinding
-	clusterrole := newClusterRoleNode(legend, "", "ClusterRole", true, false)
+	role := r.newRoleNode(namespace, "ns", "Role", true, false)
+	clusterRoleBoundLocally := r.newClusterRoleNode(namespace, "ns", "ClusterRole", true, false) // bound by (namespaced!) RoleBinding
+	clusterrole := r.newClusterRoleNode(legend, "", "ClusterRole", true, false)
 
-	roleBinding := newRoleBindingNode(namespace, "RoleBinding", false)
-	newSubjectToBindingEdge(sa, roleBinding)
-	newSubjectToBindingEdge(missingSa, roleBinding)
-	newBindingToRoleEdge(roleBinding, role)
+	roleBinding := r.newRoleBindingNode(namespace, "ns", "RoleBinding", false)
+	r.newSubjectToBindingEdge(sa, roleBinding)
+	r.newSubjectToBindingEdge(missingSa, roleBinding)
+	r.newBindingToRoleEdge(roleBinding, role)
 
-	roleBinding2 := newRoleBindingNode(namespace, "RoleBinding-to-ClusterRole", false)
+	roleBinding2 := r.newRoleBindingNode(namespace, "ns", "RoleBinding-to-ClusterRole", false)
 	roleBinding2.Attr("label", "RoleBinding")
-	newSubjectToBindingEdge(sa, roleBinding2)
-	newBindingToRoleEdge(roleBinding2, clusterRoleBoundLocally)
+	r.newSubjectToBindingEdge(sa, roleBinding2)
+	r.newBindingToRoleEdge(roleBinding2, clusterRoleBoundLocally)
+
+	clusterRoleBinding := r.newClusterRoleBindingNode(legend, "ClusterRoleBinding", false)
+	r.newSubjectToBindingEdge(sa, clusterRoleBinding)
+	r.newBindingToRoleEdge(clusterRoleBinding, clusterrole)
 
-	clusterRoleBinding := newClusterRoleBindingNode(legend, "ClusterRoleBinding", false)
-	newSubjectToBindingEdge(sa, clusterRoleBinding)
-	newBindingToRoleEdge(clusterRoleBinding, clusterrole)
+	if len(r.permissions.Namespaces) > 0 {
+		missingNamespace := r.newNamespaceSubgraph0(legend, "Other Namespace", nil, phaseMissing)
+		r.newSubjectNode0(missingNamespace, "Kind", "other-ns", "Subject in missing Namespace", "", false, false)
+	}
+
+	if r.config.showWorkloads && len(r.permissions.Workloads) > 0 {
+		workload := r.newWorkloadNode(namespace, "Kind", "ns", "Workload")
+		r.newWorkloadToServiceAccountEdge(workload, sa, true)
+	}
+
+	if r.config.showSecrets {
+		secret := r.newSecretNode0(namespace, "ns", "Secret", true, false)
+		r.newServiceAccountToSecretEdge(sa, secret, false)
+		legacyToken := r.newSecretNode0(namespace, "ns", "Legacy Token", true, true)
+		r.newServiceAccountToSecretEdge(sa, legacyToken, false)
+		imagePullSecret := r.newSecretNode0(namespace, "ns", "Image Pull Secret", true, false)
+		r.newServiceAccountToSecretEdge(sa, imagePullSecret, true)
+	}
 
 	if r.config.showRules {
-		nsrules := newRulesNode0(namespace, "ns", "Role", "Namespace-scoped\naccess rules", false)
-		newRoleToRulesEdge(role, nsrules)
+		nsrules := r.newRulesNode0(namespace, kindRole, "ns", "Role", "Namespace-scoped\naccess rules", false)
+		r.newRoleToRulesEdge(role, nsrules)
 
-		nsrules2 := newRulesNode0(namespace, "ns", "ClusterRole", "Namespace-scoped access rules From ClusterRole", false)
+		nsrules2 := r.newRulesNode0(namespace, kindClusterRole, "ns", "ClusterRole", "Namespace-scoped access rules From ClusterRole", false)
 		nsrules2.Attr("label", "Namespace-scoped\naccess rules")
-		newRoleToRulesEdge(clusterRoleBoundLocally, nsrules2)
+		r.newRoleToRulesEdge(clusterRoleBoundLocally, nsrules2)
+
+		clusterrules := r.newRulesNode0(legend, kindClusterRole, "", "ClusterRole", "Cluster-scoped\naccess rules", false)
+		r.newRoleToRulesEdge(clusterrole, clusterrules)
+	}
+}
+
+// bindingsToRender returns the bindings selected by shouldRenderBinding and, when focusing on a resource with
+// --depth N, the bindings up to N-1 steps away from them, where each step leads to the bindings that share a
+// subject or a role with the bindings found so far (RoleBindings only if their namespace is selected)
+func (r *Rback) bindingsToRender() map[NamespacedName]bool {
+	selected := map[NamespacedName]bool{}
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			if r.shouldRenderBinding(binding) {
+				selected[binding.NamespacedName] = true
+			}
+		}
+	}
 
-		clusterrules := newRulesNode0(legend, "", "ClusterRole", "Cluster-scoped\naccess rules", false)
-		newRoleToRulesEdge(clusterrole, clusterrules)
+	if r.config.resourceKind == "" {
+		return selected // everything is rendered anyway
 	}
+
+	for depth := 1; depth < r.config.depth; depth++ {
+		subjects := map[KindNamespacedName]bool{}
+		roles := map[NamespacedName]bool{}
+		for _, bindings := range r.permissions.RoleBindings {
+			for _, binding := range bindings {
+				if selected[binding.NamespacedName] {
+					roles[binding.role] = true
+					for _, subject := range binding.subjects {
+						subjects[subjectKey(subject)] = true
+					}
+				}
+			}
+		}
+
+		for _, bindings := range r.permissions.RoleBindings {
+			for _, binding := range bindings {
+				if selected[binding.NamespacedName] || !r.labelsSelected(binding.labels) {
+					continue
+				}
+				if binding.namespace != "" && !r.namespaceSelected(binding.namespace) {
+					continue // the expansion doesn't leave the namespaces selected by -n and --namespace-selector
+				}
+				related := roles[binding.role]
+				for _, subject := range binding.subjects {
+					related = related || subjects[subjectKey(subject)]
+				}
+				if related {
+					selected[binding.NamespacedName] = true
+				}
+			}
+		}
+	}
+	return selected
+}
+
+// subjectKey identifies a subject; only ServiceAccounts are namespaced
+func subjectKey(subject KindNamespacedName) KindNamespacedName {
+	if subject.kind != "ServiceAccount" {
+		subject.namespace = ""
+	}
+	return subject
 }
 
 func (r *Rback) shouldRenderBinding(binding Binding) bool {
+	if !r.labelsSelected(binding.labels) {
+		return false
+	}
+
 	switch r.config.resourceKind {
 	case "":
 		return r.namespaceSelected(binding.namespace)
@@ -176,25 +401,66 @@ func (r *Rback) shouldRenderBinding(binding Binding) bool {
 	return false
 }
 
-func (r *Rback) newBindingNode(gns *dot.Graph, binding Binding) dot.Node {
+// newNamespaceSubgraph returns the subgraph for the given namespace. If Namespace objects were part
+// of the input, the subgraph shows the namespace's labels and whether it is terminating or missing.
+func (r *Rback) newNamespaceSubgraph(g *dot.Graph, ns string) *dot.Graph {
+	namespace, exists := r.permissions.Namespaces[ns]
+	gns := r.newNamespaceSubgraph0(g, ns, namespace.labels, r.namespacePhase(ns))
+	if exists {
+		r.addDetails(gns.AttributesMap, "Namespace", "", ns, true, namespaceTooltip(namespace))
+	}
+	return gns
+}
+
+// namespacePhase returns the phase of the namespace, or phaseMissing if Namespace objects were part of the input,
+// but not this one
+func (r *Rback) namespacePhase(ns string) string {
+	namespace, exists := r.permissions.Namespaces[ns]
+	if !exists && len(r.permissions.Namespaces) > 0 {
+		return phaseMissing
+	}
+	return namespace.phase
+}
+
+func (r *Rback) newBindingNode(gns *dot.Graph, binding Binding) graphNode {
 	if binding.namespace == "" {
-		return newClusterRoleBindingNode(gns, binding.name, r.isFocused(kindClusterRoleBinding, "", binding.name))
+		focused := r.isFocused(kindClusterRoleBinding, "", binding.name)
+		id := nodeID(kindClusterRoleBinding, "", binding.name)
+		r.recordNode(id, kindClusterRoleBinding, "", binding.name, true, focused)
+		node := r.newClusterRoleBindingNode(gns, binding.name, focused)
+		r.addDetails(node.AttributesMap, "ClusterRoleBinding", "", binding.name, true, bindingTooltip(binding))
+		return graphNode{node, id}
 	} else {
-		return newRoleBindingNode(gns, binding.name, r.isFocused(kindRoleBinding, binding.namespace, binding.name))
+		focused := r.isFocused(kindRoleBinding, binding.namespace, binding.name)
+		id := nodeID(kindRoleBinding, binding.namespace, binding.name)
+		r.recordNode(id, kindRoleBinding, binding.namespace, binding.name, true, focused)
+		node := r.newRoleBindingNode(gns, binding.namespace, binding.name, focused)
+		r.addDetails(node.AttributesMap, "RoleBinding", binding.namespace, binding.name, true, bindingTooltip(binding))
+		return graphNode{node, id}
 	}
 }
 
-func (r *Rback) newRoleAndRulesNodePair(gns *dot.Graph, bindingNamespace string, role NamespacedName) dot.Node {
-	var roleNode dot.Node
+func (r *Rback) newRoleAndRulesNodePair(gns *dot.Graph, bindingNamespace string, role NamespacedName) graphNode {
+	var roleNode graphNode
+	exists := r.roleExists(role)
 	if role.namespace == "" {
-		roleNode = newClusterRoleNode(gns, bindingNamespace, role.name, r.roleExists(role), r.isFocused(kindClusterRole, role.namespace, role.name))
+		focused := r.isFocused(kindClusterRole, role.namespace, role.name)
+		roleNode.id = nodeID(kindClusterRole, bindingNamespace, role.name)
+		r.recordNode(roleNode.id, kindClusterRole, bindingNamespace, role.name, exists, focused)
+		roleNode.Node = r.newClusterRoleNode(gns, bindingNamespace, role.name, exists, focused)
+		r.addDetails(roleNode.AttributesMap, "ClusterRole", "", role.name, exists, r.roleTooltip(role))
 	} else {
-		roleNode = newRoleNode(gns, role.namespace, role.name, r.roleExists(role), r.isFocused(kindRole, role.namespace, role.name))
+		focused := r.isFocused(kindRole, role.namespace, role.name)
+		roleNode.id = nodeID(kindRole, role.namespace, role.name)
+		r.recordNode(roleNode.id, kindRole, role.namespace, role.name, exists, focused)
+		roleNode.Node = r.newRoleNode(gns, role.namespace, role.name, exists, focused)
+		r.addDetails(roleNode.AttributesMap, "Role", role.namespace, role.name, exists, r.roleTooltip(role))
 	}
 	if r.config.showRules {
-		rulesNode := r.newRulesNode(gns, role.namespace, role.name, r.isFocused(kindRule, role.namespace, role.name))
+		rulesNode := r.newRulesNode(gns, bindingNamespace, role, r.isFocused(kindRule, role.namespace, role.name))
 		if rulesNode != nil {
-			newRoleToRulesEdge(roleNode, *rulesNode)
+			r.newRoleToRulesEdge(roleNode.Node, rulesNode.Node)
+			r.recordEdge(roleNode, *rulesNode, edgeHasRules)
 		}
 	}
 	return roleNode
@@ -209,8 +475,17 @@ func (r *Rback) roleExists(role NamespacedName) bool {
 	return false
 }
 
-func (r *Rback) newSubjectNode(gns *dot.Graph, kind string, ns string, name string) dot.Node {
-	return newSubjectNode0(gns, kind, name, r.subjectExists(kind, ns, name), r.isFocused(strings.ToLower(kind), ns, name))
+func (r *Rback) newSubjectNode(gns *dot.Graph, kind string, ns string, name string) graphNode {
+	exists, focused := r.subjectExists(kind, ns, name), r.isFocused(strings.ToLower(kind), ns, name)
+	id := nodeID(kind, ns, name)
+	r.recordNode(id, strings.ToLower(kind), ns, name, exists, focused)
+	note := ""
+	if r.config.showSecrets && kind == "ServiceAccount" && exists && r.serviceAccountAutomountsToken(ns, name) {
+		note = "automounts token"
+	}
+	node := r.newSubjectNode0(gns, kind, ns, name, note, exists, focused)
+	r.addDetails(node.AttributesMap, kind, ns, name, exists, r.subjectTooltip(kind, ns, name, exists))
+	return graphNode{node, id}
 }
 
 func (r *Rback) subjectExists(kind string, ns string, name string) bool {
@@ -254,39 +529,66 @@ func (w *WhoCan) matchesAnyRuleIn(role Role) bool {
 	return false
 }
 
+// matches returns true if the rule allows the verb on the resource (or, if the resource starts with "/", on the
+// non-resource URL); without a resource name, rules restricted to resource names only match if exactName isn't set
 func (w *WhoCan) matches(rule Rule) bool {
-	return (contains(rule.verbs, "*") || contains(rule.verbs, w.verb)) &&
-		(contains(rule.resources, "*") || contains(rule.resources, w.resourceKind)) &&
-		(w.resourceName == "" || len(rule.resourceNames) == 0 || contains(rule.resourceNames, w.resourceName)) // TODO: also check API group!
+	if strings.HasPrefix(w.resourceKind, "/") {
+		return rule.allowsNonResourceURL(w.verb, w.resourceKind)
+	}
+	return matchesValueOrWildcard(rule.verbs, w.verb) &&
+		(w.apiGroup == nil || matchesValueOrWildcard(rule.apiGroups, *w.apiGroup)) &&
+		rule.allowsResource(w.resourceKind) &&
+		(len(rule.resourceNames) == 0 || contains(rule.resourceNames, w.resourceName) || (w.resourceName == "" && !w.exactName))
 }
 
-func (r *Rback) newRulesNode(g *dot.Graph, namespace, roleName string, highlight bool) *dot.Node {
+func (r *Rback) newRulesNode(g *dot.Graph, bindingNamespace string, roleRef NamespacedName, highlight bool) *graphNode {
 	var rulesText string
-	if roles, found := r.permissions.Roles[namespace]; found {
-		if role, found := roles[roleName]; found {
-			ellipsis := regularLine("...")
-			for _, rule := range role.rules {
-				ruleMatches := r.config.resourceKind == kindRule && highlight && r.config.whoCan.matches(rule)
-				if ruleMatches {
-					rulesText += boldLine(rule.toHumanReadableString())
-				} else {
-					if r.config.whoCan.showMatchedOnly {
-						if !strings.HasSuffix(rulesText, ellipsis) {
-							rulesText += ellipsis
-						}
-					} else {
-						rulesText += regularLine(rule.toHumanReadableString())
-					}
-				}
+	var tooltip []string
+	if roles, found := r.permissions.Roles[roleRef.namespace]; found {
+		if role, found := roles[roleRef.name]; found {
+			tooltip = append([]string{roleString(roleRef)}, rulesTooltip(role)...)
+			if r.config.rawRules {
+				rulesText = r.rulesLines(role.rules, highlight)
+			} else {
+				rulesText = r.rulesTable(normalizeRules(role.rules), highlight)
 			}
 		}
 	}
 	if rulesText == "" {
 		return nil
 	} else {
-		node := newRulesNode0(g, namespace, roleName, rulesText, highlight)
-		return &node
+		roleKind, roleNodeNamespace := kindRole, roleRef.namespace
+		if roleRef.namespace == "" {
+			roleKind, roleNodeNamespace = kindClusterRole, bindingNamespace
+		}
+		id := rulesNodeID(roleKind, roleNodeNamespace, roleRef.name)
+		r.recordNode(id, kindRule, roleNodeNamespace, roleRef.name, true, highlight)
+		node := r.newRulesNode0(g, roleKind, roleNodeNamespace, roleRef.name, rulesText, highlight)
+		objectKind := iff(roleRef.namespace == "", "ClusterRole", "Role")
+		r.addDetails(node.AttributesMap, objectKind, roleRef.namespace, roleRef.name, true, tooltip)
+		return &graphNode{node, id}
+	}
+}
+
+// rulesLines renders the rules line by line, as written in the role
+func (r *Rback) rulesLines(rules []Rule, highlight bool) string {
+	var rulesText string
+	ellipsis := regularLine("...")
+	for _, rule := range rules {
+		ruleMatches := r.config.resourceKind == kindRule && highlight && r.config.whoCan.matches(rule)
+		if ruleMatches {
+			rulesText += boldLine(rule.toHumanReadableString())
+		} else {
+			if r.config.whoCan.showMatchedOnly {
+				if !strings.HasSuffix(rulesText, ellipsis) {
+					rulesText += ellipsis
+				}
+			} else {
+				rulesText += regularLine(rule.toHumanReadableString())
+			}
+		}
 	}
+	return rulesText
 }
 
 func (r *Rule) toHumanReadableString() string {
@@ -307,21 +609,72 @@ func (r *Rule) toHumanReadableString() string {
 }
 
 func (r *Rback) resourceNameSelected(name string) bool {
-	return r.allResourceNames() || contains(r.config.resourceNames, name)
+	if r.allResourceNames() {
+		return true
+	}
+	return (len(r.config.resourceNames) == 0 || matchesPatterns(r.config.resourceNames, name)) &&
+		(r.config.nameRegex == nil || r.config.nameRegex.MatchString(name))
+}
+
+// labelsSelected returns true if the labels match the -selector (or if there is no selector)
+func (r *Rback) labelsSelected(labels map[string]string) bool {
+	return r.config.selector == nil || r.config.selector.matches(labels)
 }
 
 func (r *Rback) allResourceNames() bool {
-	return len(r.config.resourceNames) == 0
+	return len(r.config.resourceNames) == 0 && r.config.nameRegex == nil
 }
 
 func (r *Rback) namespaceSelected(ns string) bool {
-	return r.allNamespaces() || contains(r.config.namespaces, ns)
+	if r.allNamespaces() {
+		return true
+	}
+	return (r.noNamespacesListed() || matchesPatterns(r.config.namespaces, ns)) && r.namespaceLabelsSelected(ns)
+}
+
+// namespaceLabelsSelected returns true if the namespace's labels match the --namespace-selector
+// (namespaces that weren't part of the input are treated as having no labels)
+func (r *Rback) namespaceLabelsSelected(ns string) bool {
+	if r.config.namespaceSelector == nil {
+		return true
+	}
+	namespace, exists := r.permissions.Namespaces[ns]
+	return exists && r.config.namespaceSelector.matches(namespace.labels)
 }
 
 func (r *Rback) allNamespaces() bool {
+	return r.noNamespacesListed() && r.config.namespaceSelector == nil
+}
+
+func (r *Rback) noNamespacesListed() bool {
 	return len(r.config.namespaces) == 1 && r.config.namespaces[0] == ""
 }
 
+// matchesPatterns returns true if the value matches any of the glob patterns (e.g. "team-*") and none of
+// the negated ones (e.g. "!kube-*"). If there are only negated patterns, everything else matches.
+func matchesPatterns(patterns []string, value string) bool {
+	hasPositivePatterns, matched := false, false
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			if globMatches(pattern[1:], value) {
+				return false
+			}
+		} else {
+			hasPositivePatterns = true
+			matched = matched || globMatches(pattern, value)
+		}
+	}
+	return matched || !hasPositivePatterns
+}
+
+func globMatches(pattern, value string) bool {
+	matched, err := path.Match(pattern, value)
+	if err != nil {
+		return pattern == value // not a valid glob, so compare literally
+	}
+	return matched
+}
+
 func contains(values []string, value string) bool {
 	for _, v := range values {
 		if value == v {
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// formats of the access review report
+const (
+	reportMarkdown = "md"
+	reportHTML     = "html"
+)
+
+// AccessReport is an access review of the RBAC resources: who has which rules via which binding and role, per
+// namespace and cluster-wide
+type AccessReport struct {
+	Generated   string
+	Summary     []ReportSummaryRow
+	ClusterWide ReportSection
+	Namespaces  []ReportSection
+}
+
+type ReportSummaryRow struct {
+	Scope         string // the namespace, or "cluster"
+	Subjects      int
+	Bindings      int
+	Roles         int
+	WildcardRules int
+	Missing       int // missing subjects and roles
+}
+
+type ReportSection struct {
+	Name            string
+	Phase           string        // e.g. "Terminating" or "Missing"
+	Grants          []ReportGrant // by the (Cluster)RoleBindings of the section
+	ClusterGrants   []ReportGrant // by ClusterRoleBindings to the ServiceAccounts of the namespace, without rules
+	WithoutGrants   []string      // ServiceAccounts of the namespace without any grants
+	MissingSubjects []string
+	MissingRoles    []string
+}
+
+type ReportGrant struct {
+	Subject        string
+	SubjectMissing bool
+	Binding        string
+	Role           string
+	RoleMissing    bool
+	Rules          []string
+}
+
+// accessReport collects the report from the permissions, for the selected namespaces and bindings
+func (r *Rback) accessReport() AccessReport {
+	report := AccessReport{Generated: time.Now().Format("2006-01-02 15:04 MST")}
+
+	report.ClusterWide = r.reportSection("")
+	report.Summary = append(report.Summary, r.reportSummaryRow("", report.ClusterWide))
+	for _, ns := range r.allNamespaceNames() {
+		if !r.namespaceSelected(ns) {
+			continue
+		}
+		section := r.reportSection(ns)
+		for _, grant := range report.ClusterWide.Grants {
+			if strings.HasPrefix(grant.Subject, "ServiceAccount "+ns+"/") {
+				grant.Rules = nil
+				section.ClusterGrants = append(section.ClusterGrants, grant)
+			}
+		}
+		for name := range r.permissions.ServiceAccounts[ns] {
+			sa := KindNamespacedName{"ServiceAccount", NamespacedName{ns, name}}
+			if len(r.grantsFor(sa)) == 0 && r.labelsSelected(r.serviceAccountLabels(ns, name)) {
+				section.WithoutGrants = append(section.WithoutGrants, subjectString(sa))
+			}
+		}
+		sort.Strings(section.WithoutGrants)
+		report.Namespaces = append(report.Namespaces, section)
+		report.Summary = append(report.Summary, r.reportSummaryRow(ns, section))
+	}
+	return report
+}
+
+// reportSection collects the grants of the bindings in the namespace ("" for ClusterRoleBindings)
+func (r *Rback) reportSection(ns string) ReportSection {
+	section := ReportSection{Name: ns}
+	if ns != "" {
+		section.Phase = r.namespacePhase(ns)
+	}
+
+	missingSubjects, missingRoles := map[string]bool{}, map[string]bool{}
+	bindings := r.permissions.RoleBindings[ns]
+	for _, name := range sortedBindingNames(bindings) {
+		binding := bindings[name]
+		if !r.labelsSelected(binding.labels) {
+			continue
+		}
+		role, roleExists := r.permissions.Roles[binding.role.namespace][binding.role.name]
+		if !roleExists {
+			missingRoles[roleString(binding.role)] = true
+		}
+		rules := []string{}
+		if !r.config.rawRules {
+			role.rules = normalizeRules(role.rules)
+		}
+		for _, rule := range role.rules {
+			rules = append(rules, rule.toHumanReadableString())
+		}
+
+		for _, subject := range binding.subjects {
+			subjectExists := r.subjectExists(subject.kind, subject.namespace, subject.name)
+			if !subjectExists {
+				missingSubjects[subjectString(subject)] = true
+			}
+			section.Grants = append(section.Grants, ReportGrant{subjectString(subject), !subjectExists,
+				bindingString(binding), roleString(binding.role), !roleExists, rules})
+		}
+	}
+	sort.SliceStable(section.Grants, func(i, j int) bool {
+		return section.Grants[i].Subject < section.Grants[j].Subject
+	})
+	section.MissingSubjects = sortedKeys(missingSubjects)
+	section.MissingRoles = sortedKeys(missingRoles)
+	return section
+}
+
+func (r *Rback) reportSummaryRow(ns string, section ReportSection) ReportSummaryRow {
+	row := ReportSummaryRow{Scope: scopeString(ns)}
+	for _, binding := range r.permissions.RoleBindings[ns] {
+		if r.labelsSelected(binding.labels) {
+			row.Bindings++
+		}
+	}
+	subjects := map[string]bool{}
+	for _, grant := range section.Grants {
+		subjects[grant.Subject] = true
+	}
+	for _, sa := range section.WithoutGrants {
+		subjects[sa] = true
+	}
+	row.Subjects = len(subjects)
+	for _, role := range r.permissions.Roles[ns] {
+		if !r.labelsSelected(role.labels) {
+			continue
+		}
+		row.Roles++
+		for _, rule := range role.rules {
+			if contains(rule.verbs, "*") || contains(rule.resources, "*") || contains(rule.apiGroups, "*") || contains(rule.nonResourceURLs, "*") {
+				row.WildcardRules++
+			}
+		}
+	}
+	row.Missing = len(section.MissingSubjects) + len(section.MissingRoles)
+	return row
+}
+
+// printReport prints the access review report as Markdown or HTML
+func (r *Rback) printReport(w io.Writer) error {
+	report := r.accessReport()
+	switch r.config.reportFormat {
+	case reportMarkdown:
+		return writeMarkdownReport(w, report)
+	case reportHTML:
+		return htmlReportTemplate.Execute(w, report)
+	}
+	return fmt.Errorf("Unsupported report format %q (supported: %s, %s)", r.config.reportFormat, reportMarkdown, reportHTML)
+}
+
+func writeMarkdownReport(w io.Writer, report AccessReport) error {
+	fmt.Fprintf(w, "# RBAC access review\n\nGenerated by rback on %s.\n\n", report.Generated)
+
+	fmt.Fprintln(w, "## Summary")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Scope | Subjects | Bindings | Roles | Wildcard rules | Missing subjects and roles |")
+	fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: | ---: |")
+	for _, row := range report.Summary {
+		fmt.Fprintf(w, "| %s | %d | %d | %d | %d | %d |\n", markdownCell(row.Scope), row.Subjects, row.Bindings, row.Roles, row.WildcardRules, row.Missing)
+	}
+
+	fmt.Fprintln(w, "\n## Cluster-wide")
+	fmt.Fprintln(w, "\nGrants by ClusterRoleBindings, which apply in all namespaces.")
+	writeMarkdownSection(w, report.ClusterWide)
+
+	for _, section := range report.Namespaces {
+		fmt.Fprintf(w, "\n## Namespace %s", markdownCell(section.Name))
+		if section.Phase == phaseMissing || section.Phase == phaseTerminating {
+			fmt.Fprintf(w, " (%s)", section.Phase)
+		}
+		fmt.Fprintln(w)
+		writeMarkdownSection(w, section)
+	}
+
+	_, err := fmt.Fprint(w, "\n## Sign-off\n\n| Reviewer | Date | Signature |\n| --- | --- | --- |\n|  |  |  |\n")
+	return err
+}
+
+func writeMarkdownSection(w io.Writer, section ReportSection) {
+	if len(section.Grants) == 0 {
+		fmt.Fprintln(w, "\nNo grants.")
+	} else {
+		fmt.Fprintln(w, "\n| Subject | Binding | Role | Rules |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- |")
+		for _, grant := range section.Grants {
+			rules := []string{}
+			for _, rule := range grant.Rules {
+				rules = append(rules, "`"+markdownCell(rule)+"`")
+			}
+			fmt.Fprintf(w, "| %s%s | %s | %s%s | %s |\n", markdownCell(grant.Subject), iff(grant.SubjectMissing, " **(missing)**", ""),
+				markdownCell(grant.Binding), markdownCell(grant.Role), iff(grant.RoleMissing, " **(missing)**", ""), strings.Join(rules, "<br>"))
+		}
+	}
+
+	if len(section.ClusterGrants) > 0 {
+		fmt.Fprintln(w, "\nCluster-wide grants to ServiceAccounts of this namespace (see _Cluster-wide_ for the rules):")
+		fmt.Fprintln(w)
+		for _, grant := range section.ClusterGrants {
+			fmt.Fprintf(w, "- %s via %s of %s\n", markdownCell(grant.Subject), markdownCell(grant.Binding), markdownCell(grant.Role))
+		}
+	}
+	writeMarkdownList(w, "ServiceAccounts without grants", section.WithoutGrants)
+	writeMarkdownList(w, "Missing subjects", section.MissingSubjects)
+	writeMarkdownList(w, "Missing roles", section.MissingRoles)
+}
+
+func writeMarkdownList(w io.Writer, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s:\n\n", title)
+	for _, item := range items {
+		fmt.Fprintf(w, "- %s\n", markdownCell(item))
+	}
+}
+
+// markdownCell escapes the characters that would end a table cell or a code span
+func markdownCell(text string) string {
+	return strings.NewReplacer(`|`, `\|`, "`", "'").Replace(text)
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>RBAC access review</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; }
+  table { border-collapse: collapse; margin: 1em 0; }
+  th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+  td.number { text-align: right; }
+  code { white-space: nowrap; }
+  .missing { color: #c00; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>RBAC access review</h1>
+<p>Generated by rback on {{.Generated}}.</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Scope</th><th>Subjects</th><th>Bindings</th><th>Roles</th><th>Wildcard rules</th><th>Missing subjects and roles</th></tr>
+{{range .Summary}}<tr><td>{{.Scope}}</td><td class="number">{{.Subjects}}</td><td class="number">{{.Bindings}}</td><td class="number">{{.Roles}}</td><td class="number">{{.WildcardRules}}</td><td class="number">{{.Missing}}</td></tr>
+{{end}}</table>
+
+<h2>Cluster-wide</h2>
+<p>Grants by ClusterRoleBindings, which apply in all namespaces.</p>
+{{template "section" .ClusterWide}}
+
+{{range .Namespaces}}<h2>Namespace {{.Name}}{{if or (eq .Phase "Missing") (eq .Phase "Terminating")}} ({{.Phase}}){{end}}</h2>
+{{template "section" .}}
+{{end}}
+<h2>Sign-off</h2>
+<table>
+<tr><th>Reviewer</th><th>Date</th><th>Signature</th></tr>
+<tr><td>&nbsp;</td><td>&nbsp;</td><td>&nbsp;</td></tr>
+</table>
+</body>
+</html>
+{{define "section"}}{{if .Grants}}<table>
+<tr><th>Subject</th><th>Binding</th><th>Role</th><th>Rules</th></tr>
+{{range .Grants}}<tr><td>{{.Subject}}{{if .SubjectMissing}} <span class="missing">(missing)</span>{{end}}</td><td>{{.Binding}}</td><td>{{.Role}}{{if .RoleMissing}} <span class="missing">(missing)</span>{{end}}</td><td>{{range $i, $rule := .Rules}}{{if $i}}<br>{{end}}<code>{{$rule}}</code>{{end}}</td></tr>
+{{end}}</table>
+{{else}}<p>No grants.</p>
+{{end}}{{if .ClusterGrants}}<p>Cluster-wide grants to ServiceAccounts of this namespace (see <em>Cluster-wide</em> for the rules):</p>
+<ul>
+{{range .ClusterGrants}}<li>{{.Subject}} via {{.Binding}} of {{.Role}}</li>
+{{end}}</ul>
+{{end}}{{if .WithoutGrants}}<p>ServiceAccounts without grants:</p>
+<ul>
+{{range .WithoutGrants}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}{{if .MissingSubjects}}<p>Missing subjects:</p>
+<ul>
+{{range .MissingSubjects}}<li class="missing">{{.}}</li>
+{{end}}</ul>
+{{end}}{{if .MissingRoles}}<p>Missing roles:</p>
+<ul>
+{{range .MissingRoles}}<li class="missing">{{.}}</li>
+{{end}}</ul>
+{{end}}{{end}}`))
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SubjectAccessReview is an authorization.k8s.io/v1 (or v1beta1) SubjectAccessReview
+type SubjectAccessReview struct {
+	APIVersion string                    `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string                    `json:"kind" yaml:"kind"`
+	Metadata   map[string]interface{}    `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Spec       SubjectAccessReviewSpec   `json:"spec" yaml:"spec"`
+	Status     SubjectAccessReviewStatus `json:"status" yaml:"status"`
+
+	expectedAllowed *bool // the status.allowed given in the review file, if any
+}
+
+type SubjectAccessReviewSpec struct {
+	ResourceAttributes    *ResourceAttributes    `json:"resourceAttributes,omitempty" yaml:"resourceAttributes,omitempty"`
+	NonResourceAttributes *NonResourceAttributes `json:"nonResourceAttributes,omitempty" yaml:"nonResourceAttributes,omitempty"`
+	User                  string                 `json:"user,omitempty" yaml:"user,omitempty"`
+	Groups                []string               `json:"groups,omitempty" yaml:"groups,omitempty"`
+	GroupsV1beta1         []string               `json:"group,omitempty" yaml:"group,omitempty"` // v1beta1 calls the groups "group"
+	UID                   string                 `json:"uid,omitempty" yaml:"uid,omitempty"`
+	Extra                 map[string][]string    `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+type ResourceAttributes struct {
+	Namespace   string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Verb        string `json:"verb,omitempty" yaml:"verb,omitempty"`
+	Group       string `json:"group,omitempty" yaml:"group,omitempty"`
+	Version     string `json:"version,omitempty" yaml:"version,omitempty"`
+	Resource    string `json:"resource,omitempty" yaml:"resource,omitempty"`
+	Subresource string `json:"subresource,omitempty" yaml:"subresource,omitempty"`
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+type NonResourceAttributes struct {
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	Verb string `json:"verb,omitempty" yaml:"verb,omitempty"`
+}
+
+type SubjectAccessReviewStatus struct {
+	Allowed bool   `json:"allowed" yaml:"allowed"`
+	Denied  bool   `json:"denied,omitempty" yaml:"denied,omitempty"`
+	Reason  string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// review decides the SubjectAccessReview like the API server's RBAC authorizer (i.e. without adding any groups the
+// subject might be a member of) and sets its status; requests that no rule allows aren't explicitly denied
+func (r *Rback) review(sar *SubjectAccessReview) {
+	spec := sar.Spec
+	groups := append(append([]string{}, spec.Groups...), spec.GroupsV1beta1...)
+
+	var namespace string
+	var whoCan WhoCan
+	switch {
+	case spec.ResourceAttributes != nil:
+		attributes := spec.ResourceAttributes
+		namespace = attributes.Namespace
+		resource := attributes.Resource
+		if attributes.Subresource != "" {
+			resource += "/" + attributes.Subresource
+		}
+		whoCan = WhoCan{verb: attributes.Verb, resourceKind: resource, resourceName: attributes.Name, apiGroup: &attributes.Group, exactName: true}
+	case spec.NonResourceAttributes != nil:
+		whoCan = WhoCan{verb: spec.NonResourceAttributes.Verb, resourceKind: spec.NonResourceAttributes.Path}
+		if !strings.HasPrefix(whoCan.resourceKind, "/") {
+			whoCan.resourceKind = "/" + whoCan.resourceKind
+		}
+	default:
+		sar.Status = SubjectAccessReviewStatus{Reason: "neither resourceAttributes nor nonResourceAttributes given"}
+		return
+	}
+
+	subjects := []KindNamespacedName{}
+	if spec.User != "" {
+		subjects = append(subjects, subjectFromUsername(spec.User))
+	}
+	for _, group := range groups {
+		subjects = append(subjects, KindNamespacedName{"Group", NamespacedName{"", group}})
+	}
+
+	// like the API server, ClusterRoleBindings are evaluated before the RoleBindings of the namespace
+	scopes := []string{""}
+	if namespace != "" && spec.NonResourceAttributes == nil {
+		scopes = append(scopes, namespace)
+	}
+	for _, scope := range scopes {
+		bindings := r.permissions.RoleBindings[scope]
+		for _, name := range sortedBindingNames(bindings) {
+			binding := bindings[name]
+			role, found := r.permissions.Roles[binding.role.namespace][binding.role.name]
+			if !found {
+				continue
+			}
+			for _, subject := range subjects {
+				if !binding.hasSubject(subject) {
+					continue
+				}
+				for _, rule := range role.rules {
+					if whoCan.matches(rule) {
+						sar.Status = SubjectAccessReviewStatus{Allowed: true, Reason: fmt.Sprintf("RBAC: allowed by %s of %s to %s (rule: %s)",
+							bindingString(binding), roleString(binding.role), subjectString(subject), rule.toHumanReadableString())}
+						return
+					}
+				}
+			}
+		}
+	}
+	sar.Status = SubjectAccessReviewStatus{Reason: "RBAC: no binding grants a matching rule"}
+}
+
+func sortedBindingNames(bindings map[string]Binding) []string {
+	names := []string{}
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readSubjectAccessReviews reads the SubjectAccessReviews in the file (JSON or YAML, possibly with multiple documents)
+func readSubjectAccessReviews(file string) ([]SubjectAccessReview, error) {
+	items, err := readManifests(file)
+	if err != nil {
+		return nil, err
+	}
+	reviews := []SubjectAccessReview{}
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var sar SubjectAccessReview
+		if err := json.Unmarshal(data, &sar); err != nil {
+			return nil, err
+		}
+		if sar.Kind != "SubjectAccessReview" {
+			return nil, fmt.Errorf("Expected kind=SubjectAccessReview, but found %s", sar.Kind)
+		}
+		if status, found := item.(map[string]interface{})["status"].(map[string]interface{}); found {
+			if allowed, found := status["allowed"].(bool); found {
+				sar.expectedAllowed = &allowed
+			}
+		}
+		reviews = append(reviews, sar)
+	}
+	return reviews, nil
+}
+
+// printReviews decides the SubjectAccessReviews in the review files; it returns an error if the decision differs
+// from the status given in a review (i.e. the status is used as the expected decision, if there is one)
+func (r *Rback) printReviews(w io.Writer) error {
+	reviews := []SubjectAccessReview{}
+	for _, file := range r.config.reviewFiles {
+		fileReviews, err := readSubjectAccessReviews(file)
+		if err != nil {
+			return fmt.Errorf("Can't read %s: %v", file, err)
+		}
+		reviews = append(reviews, fileReviews...)
+	}
+
+	mismatches := 0
+	for i := range reviews {
+		r.review(&reviews[i])
+		if expected := reviews[i].expectedAllowed; expected != nil && *expected != reviews[i].Status.Allowed {
+			mismatches++
+			if r.config.outputFormat == "" || r.config.outputFormat == "text" {
+				fmt.Fprintf(w, "MISMATCH expected %s: ", iff(*expected, "allowed", "denied"))
+			}
+		}
+		if r.config.outputFormat == "" || r.config.outputFormat == "text" {
+			fmt.Fprintf(w, "%s %s: %s\n", iff(reviews[i].Status.Allowed, "ALLOWED", "DENIED"), reviewString(reviews[i].Spec), reviews[i].Status.Reason)
+		}
+	}
+
+	switch r.config.outputFormat {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(reviews); err != nil {
+			return err
+		}
+	case "yaml":
+		for _, review := range reviews {
+			data, err := yaml.Marshal(review)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "---\n%s", data)
+		}
+	case "", "text":
+	default:
+		return fmt.Errorf("Unsupported output format %q (supported: text, json, yaml)", r.config.outputFormat)
+	}
+
+	if mismatches > 0 {
+		return fmt.Errorf("%d decision(s) differ from the expected status", mismatches)
+	}
+	return nil
+}
+
+// reviewString describes the request of the review, e.g. "User alice get pods/log in team-a"
+func reviewString(spec SubjectAccessReviewSpec) string {
+	who := []string{subjectString(subjectFromUsername(spec.User))}
+	if groups := append(append([]string{}, spec.Groups...), spec.GroupsV1beta1...); len(groups) > 0 {
+		who = append(who, "(groups "+strings.Join(groups, ",")+")")
+	}
+	if a := spec.NonResourceAttributes; a != nil {
+		return strings.Join(who, " ") + " " + a.Verb + " " + a.Path
+	}
+	if a := spec.ResourceAttributes; a != nil {
+		what := a.Resource
+		if a.Group != "" {
+			what += "." + a.Group
+		}
+		if a.Subresource != "" {
+			what += "/" + a.Subresource
+		}
+		if a.Name != "" {
+			what += " " + a.Name
+		}
+		if a.Namespace != "" {
+			what += " in " + a.Namespace
+		}
+		return strings.Join(who, " ") + " " + a.Verb + " " + what
+	}
+	return strings.Join(who, " ")
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// normalizeRules returns an equivalent, compact list of rules: every resource rule applies to a single API group,
+// verbs are sorted canonically, rules that only differ in their verbs or only in their resources (or non-resource
+// URLs) are merged, and rules that are fully covered by another rule are dropped. The rules are sorted by API group,
+// followed by the non-resource rules.
+func normalizeRules(rules []Rule) []Rule {
+	normalized := []Rule{}
+	for _, rule := range rules {
+		if len(rule.nonResourceURLs) > 0 {
+			normalized = append(normalized, canonicalRule(Rule{verbs: rule.verbs, nonResourceURLs: rule.nonResourceURLs}))
+		}
+		if len(rule.resources) > 0 && len(rule.apiGroups) > 0 {
+			for _, group := range dedupe(rule.apiGroups) {
+				normalized = append(normalized, canonicalRule(Rule{verbs: rule.verbs, resources: rule.resources, resourceNames: rule.resourceNames, apiGroups: []string{group}}))
+			}
+		} else if len(rule.nonResourceURLs) == 0 {
+			normalized = append(normalized, canonicalRule(rule)) // invalid rule (e.g. without API groups), kept as is
+		}
+	}
+
+	for {
+		count := len(normalized)
+		normalized = mergeRules(normalized, func(rule Rule) string {
+			return strings.Join([]string{join(rule.apiGroups), join(rule.resources), join(rule.resourceNames), join(rule.nonResourceURLs)}, "|")
+		}, func(into *Rule, rule Rule) {
+			into.verbs = append(into.verbs, rule.verbs...)
+		})
+		normalized = mergeRules(normalized, func(rule Rule) string {
+			return strings.Join([]string{join(rule.apiGroups), join(rule.verbs), join(rule.resourceNames), iff(len(rule.nonResourceURLs) > 0, "urls", "")}, "|")
+		}, func(into *Rule, rule Rule) {
+			into.resources = append(into.resources, rule.resources...)
+			into.nonResourceURLs = append(into.nonResourceURLs, rule.nonResourceURLs...)
+		})
+		if len(normalized) == count {
+			break
+		}
+	}
+
+	result := []Rule{}
+	for i, rule := range normalized {
+		subsumed := false
+		for j, other := range normalized {
+			// of two identical rules, only the first one is kept
+			if i != j && other.covers(rule) && (!rule.covers(other) || j < i) {
+				subsumed = true
+				break
+			}
+		}
+		if !subsumed {
+			result = append(result, rule)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if (len(a.nonResourceURLs) > 0) != (len(b.nonResourceURLs) > 0) {
+			return len(b.nonResourceURLs) > 0
+		}
+		if join(a.apiGroups) != join(b.apiGroups) {
+			return join(a.apiGroups) < join(b.apiGroups)
+		}
+		return join(a.resources)+join(a.nonResourceURLs) < join(b.resources)+join(b.nonResourceURLs)
+	})
+	return result
+}
+
+// mergeRules merges all rules with the same key (keeping the position of the first one)
+func mergeRules(rules []Rule, key func(Rule) string, merge func(into *Rule, rule Rule)) []Rule {
+	merged := []Rule{}
+	indexByKey := map[string]int{}
+	for _, rule := range rules {
+		k := key(rule)
+		if i, found := indexByKey[k]; found {
+			merge(&merged[i], rule)
+			merged[i] = canonicalRule(merged[i])
+		} else {
+			indexByKey[k] = len(merged)
+			merged = append(merged, rule)
+		}
+	}
+	return merged
+}
+
+// canonicalRule returns a copy of the rule with sorted, deduplicated values and wildcards replacing all other values
+func canonicalRule(rule Rule) Rule {
+	return Rule{
+		verbs:           sortVerbs(wildcardOrDeduped(rule.verbs)),
+		resources:       wildcardOrDeduped(rule.resources),
+		resourceNames:   dedupe(rule.resourceNames),
+		nonResourceURLs: wildcardOrDeduped(rule.nonResourceURLs),
+		apiGroups:       wildcardOrDeduped(rule.apiGroups),
+	}
+}
+
+// covers returns true if the rule allows everything the other rule allows
+func (rule Rule) covers(other Rule) bool {
+	for _, verb := range other.verbs {
+		if !matchesValueOrWildcard(rule.verbs, verb) {
+			return false
+		}
+	}
+	if len(other.nonResourceURLs) > 0 {
+		for _, url := range other.nonResourceURLs {
+			if !rule.matchesNonResourceURL(url) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if len(other.resources) == 0 || len(rule.resources) == 0 {
+		return false
+	}
+	for _, group := range other.apiGroups {
+		if !matchesValueOrWildcard(rule.apiGroups, group) {
+			return false
+		}
+	}
+	for _, resource := range other.resources {
+		if !rule.allowsResource(resource) {
+			return false
+		}
+	}
+	if len(rule.resourceNames) == 0 {
+		return true
+	}
+	if len(other.resourceNames) == 0 {
+		return false
+	}
+	for _, name := range other.resourceNames {
+		if !contains(rule.resourceNames, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// rulesTable renders the rules as an HTML table with a row per rule, grouped by API group; rules matching who-can
+// are shown in bold (or, with --show-matched-rules-only, exclusively)
+func (r *Rback) rulesTable(rules []Rule, highlight bool) string {
+	rows := ""
+	group := "-"
+	ellipsis := `<tr><td align="left" colspan="2">...</td></tr>`
+	for _, rule := range rules {
+		ruleMatches := r.config.resourceKind == kindRule && highlight && r.config.whoCan.matches(rule)
+		if !ruleMatches && r.config.whoCan.showMatchedOnly {
+			if !strings.HasSuffix(rows, ellipsis) {
+				rows += ellipsis
+			}
+			continue
+		}
+
+		if ruleGroup := apiGroupTitle(rule); ruleGroup != group {
+			group = ruleGroup
+			rows += `<tr><td align="left" colspan="2"><u>` + escapeHTML(group) + `</u></td></tr>`
+		}
+
+		what := join(rule.resources)
+		if len(rule.resourceNames) > 0 {
+			what += ` "` + join(rule.resourceNames) + `"`
+		}
+		if len(rule.nonResourceURLs) > 0 {
+			what = join(rule.nonResourceURLs)
+		}
+		cells := []string{join(rule.verbs), what}
+		for i, cell := range cells {
+			cell = escapeHTML(cell)
+			if ruleMatches {
+				cell = "<b>" + cell + "</b>"
+			}
+			cells[i] = `<td align="left">` + cell + `</td>`
+		}
+		rows += "<tr>" + strings.Join(cells, "") + "</tr>"
+	}
+	if rows == "" {
+		return ""
+	}
+	return `<table border="0" cellborder="0" cellspacing="0" cellpadding="1">` + rows + `</table>`
+}
+
+func apiGroupTitle(rule Rule) string {
+	switch {
+	case len(rule.nonResourceURLs) > 0:
+		return "non-resource URLs"
+	case len(rule.apiGroups) == 0:
+		return "no API group"
+	case rule.apiGroups[0] == "":
+		return "core"
+	case rule.apiGroups[0] == "*":
+		return "all API groups"
+	}
+	return join(rule.apiGroups)
+}
+
+// wildcardOrDeduped returns just the wildcard if the values contain it, and the sorted, deduplicated values otherwise
+func wildcardOrDeduped(values []string) []string {
+	if contains(values, "*") {
+		return []string{"*"}
+	}
+	return dedupe(values)
+}
+
+func dedupe(values []string) []string {
+	set := map[string]bool{}
+	for _, v := range values {
+		set[v] = true
+	}
+	result := setToSlice(set)
+	sort.Strings(result)
+	return result
+}
+
+func join(values []string) string {
+	return strings.Join(values, ",")
+}
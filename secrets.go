@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/emicklei/dot"
+)
+
+// secretTypeServiceAccountToken is the type of legacy, long-lived ServiceAccount token Secrets
+const secretTypeServiceAccountToken = "kubernetes.io/service-account-token"
+
+// renderSecrets draws the Secrets and image pull Secrets referenced by the given ServiceAccounts, as well as the
+// token Secrets that belong to them (if Secrets are part of the input)
+func (r *Rback) renderSecrets(g *dot.Graph, saNodes map[NamespacedName]graphNode) {
+	if !r.config.showSecrets {
+		return
+	}
+
+	for sa, saNode := range saNodes {
+		if r.collapsedNamespaces[sa.namespace] || !r.subjectExists("ServiceAccount", sa.namespace, sa.name) {
+			continue
+		}
+		gns := r.newNamespaceSubgraph(g, sa.namespace)
+
+		secrets, imagePullSecrets := r.serviceAccountSecrets(sa.namespace, sa.name)
+		for _, name := range r.tokenSecretsOf(sa) {
+			if !contains(secrets, name) {
+				secrets = append(secrets, name)
+			}
+		}
+		for _, name := range secrets {
+			secretNode := r.newSecretNode(gns, sa.namespace, name)
+			r.newServiceAccountToSecretEdge(saNode.Node, secretNode.Node, false)
+			r.recordEdge(saNode, secretNode, edgeReferencesSecret)
+		}
+		for _, name := range imagePullSecrets {
+			secretNode := r.newSecretNode(gns, sa.namespace, name)
+			r.newServiceAccountToSecretEdge(saNode.Node, secretNode.Node, true)
+			r.recordEdge(saNode, secretNode, edgeImagePullSecret)
+		}
+	}
+}
+
+// tokenSecretsOf returns the names of the token Secrets that belong to the ServiceAccount
+func (r *Rback) tokenSecretsOf(sa NamespacedName) []string {
+	names := []string{}
+	for name, secret := range r.permissions.Secrets[sa.namespace] {
+		if secret.secretType == secretTypeServiceAccountToken && secret.serviceAccountName == sa.name {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newSecretNode draws a Secret. If Secrets are part of the input, Secrets that aren't are drawn as missing.
+func (r *Rback) newSecretNode(gns *dot.Graph, ns, name string) graphNode {
+	secret, found := r.permissions.Secrets[ns][name]
+	exists := found || len(r.permissions.Secrets) == 0
+	legacyToken := secret.secretType == secretTypeServiceAccountToken
+
+	id := nodeID(kindSecret, ns, name)
+	r.recordNode(id, kindSecret, ns, name, exists, false)
+	node := r.newSecretNode0(gns, ns, name, exists, legacyToken)
+	tooltip := []string{"Secret " + qualifiedName(ns, name), "(missing)"}
+	if found {
+		tooltip = secretTooltip(secret)
+	} else if exists {
+		tooltip = tooltip[:1]
+	}
+	r.addDetails(node.AttributesMap, "Secret", ns, name, exists, tooltip)
+	return graphNode{node, id}
+}
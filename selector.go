@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LabelSelector is a parsed Kubernetes label selector (e.g. "team=a,env in (prod,staging),!deprecated").
+// All requirements must match for the selector to match; a nil selector matches everything.
+type LabelSelector []labelRequirement
+
+type labelRequirement struct {
+	key      string
+	operator string
+	values   []string
+}
+
+const (
+	selectorOpEquals       = "="
+	selectorOpNotEquals    = "!="
+	selectorOpIn           = "in"
+	selectorOpNotIn        = "notin"
+	selectorOpExists       = "exists"
+	selectorOpDoesNotExist = "!"
+)
+
+func parseLabelSelector(selector string) (LabelSelector, error) {
+	if strings.TrimSpace(selector) == "" {
+		return nil, nil
+	}
+
+	var result LabelSelector
+	for _, term := range splitSelectorTerms(selector) {
+		term = strings.TrimSpace(term)
+		requirement, err := parseLabelRequirement(term)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid label selector %q: %v", selector, err)
+		}
+		result = append(result, requirement)
+	}
+	return result, nil
+}
+
+// splitSelectorTerms splits the selector at commas that aren't enclosed in parentheses
+func splitSelectorTerms(selector string) []string {
+	terms := []string{}
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, selector[start:])
+}
+
+func parseLabelRequirement(term string) (labelRequirement, error) {
+	if term == "" {
+		return labelRequirement{}, fmt.Errorf("empty requirement")
+	}
+
+	if strings.HasPrefix(term, "!") {
+		return labelRequirement{key: strings.TrimSpace(term[1:]), operator: selectorOpDoesNotExist}, nil
+	}
+
+	for _, op := range []string{selectorOpNotIn, selectorOpIn} {
+		if i := strings.Index(term, " "+op+" "); i > 0 {
+			values := strings.TrimSpace(term[i+len(op)+2:])
+			if !strings.HasPrefix(values, "(") || !strings.HasSuffix(values, ")") {
+				return labelRequirement{}, fmt.Errorf("values of %q must be enclosed in parentheses", term)
+			}
+			return labelRequirement{
+				key:      strings.TrimSpace(term[:i]),
+				operator: op,
+				values:   splitAndTrim(values[1 : len(values)-1]),
+			}, nil
+		}
+	}
+
+	for _, op := range []string{"!=", "==", "="} {
+		if i := strings.Index(term, op); i > 0 {
+			operator := selectorOpEquals
+			if op == "!=" {
+				operator = selectorOpNotEquals
+			}
+			return labelRequirement{
+				key:      strings.TrimSpace(term[:i]),
+				operator: operator,
+				values:   []string{strings.TrimSpace(term[i+len(op):])},
+			}, nil
+		}
+	}
+
+	if strings.ContainsAny(term, " ()") {
+		return labelRequirement{}, fmt.Errorf("can't parse %q", term)
+	}
+	return labelRequirement{key: term, operator: selectorOpExists}, nil
+}
+
+func splitAndTrim(str string) []string {
+	values := []string{}
+	for _, v := range strings.Split(str, ",") {
+		values = append(values, strings.TrimSpace(v))
+	}
+	return values
+}
+
+func (s LabelSelector) matches(labels map[string]string) bool {
+	for _, requirement := range s {
+		if !requirement.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (req labelRequirement) matches(labels map[string]string) bool {
+	value, exists := labels[req.key]
+	switch req.operator {
+	case selectorOpExists:
+		return exists
+	case selectorOpDoesNotExist:
+		return !exists
+	case selectorOpEquals, selectorOpIn:
+		return exists && contains(req.values, value)
+	case selectorOpNotEquals, selectorOpNotIn:
+		return !exists || !contains(req.values, value)
+	}
+	return false
+}
+
+// formatLabels returns the labels as sorted "key=value" strings
+func formatLabels(labels map[string]string) []string {
+	result := []string{}
+	for k, v := range labels {
+		result = append(result, k+"="+v)
+	}
+	sort.Strings(result)
+	return result
+}
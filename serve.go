@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// server answers queries on the RBAC resources of a snapshot, which is parsed once on start
+type server struct {
+	rback      Rback
+	unfiltered Rback // the snapshot parsed without ignoring any prefixes, for authorization decisions and metrics
+}
+
+// requestParameters are the query parameters that aren't flags
+var requestParameters = []string{"kind", "name", "verb", "resource", "namespace", "group"}
+
+// serverOnlyFlags are the flags that can't be set per request, since they apply to parsing the snapshot, access
+// files on the server or, like the links of the URL template (e.g. javascript: URLs), end up in served images
+var serverOnlyFlags = []string{"f", "output-file", "watch", "profile", "ignore-prefixes", "snapshot", "listen", "url-template"}
+
+// graphFormats are the image formats rendered by GraphViz's dot, if it's installed on the server
+var graphFormats = map[string]string{
+	"svg": "image/svg+xml",
+	"png": "image/png",
+	"pdf": "application/pdf",
+}
+
+func (r *Rback) serve() error {
+	s := &server{rback: *r, unfiltered: *r}
+	if len(r.config.ignoredPrefixes) > 0 {
+		// decisions have to take the ignored bindings and subjects (e.g. system:masters) into account as well
+		s.unfiltered.config.ignoredPrefixes = nil
+		reader, err := openInput(r.config.inputFile)
+		if err != nil {
+			return err
+		}
+		err = s.unfiltered.parseRBAC(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleUI)
+	mux.HandleFunc("/api/graph", s.handleGraph)
+	mux.HandleFunc("/api/who-can", s.handleWhoCan)
+	mux.HandleFunc("/api/subjects", s.handleSubjects)
+	mux.HandleFunc("/api/permissions", s.handlePermissions)
+	mux.HandleFunc("/api/authorize", s.handleSubjectAccessReview)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	log.Printf("Serving %s on %s", r.config.inputFile, r.config.listenAddress)
+	httpServer := &http.Server{
+		Addr:              r.config.listenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      2 * time.Minute, // rendering images of big graphs takes a while
+		IdleTimeout:       2 * time.Minute,
+	}
+	return httpServer.ListenAndServe()
+}
+
+func (s *server) handleUI(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, uiHTML)
+}
+
+// handleGraph renders the graph command, e.g. /api/graph?kind=sa&name=app&n=team-a&output=svg
+func (s *server) handleGraph(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	args := []string{}
+	if kind := query.Get("kind"); kind != "" {
+		args = append([]string{kind}, query["name"]...)
+	}
+	s.render(w, commandGraph, args, query)
+}
+
+// handleWhoCan returns the subjects that can perform the verb on the resource as JSON, or renders them with an
+// output format, e.g. /api/who-can?verb=get&resource=secrets&namespace=team-a
+func (s *server) handleWhoCan(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	args := []string{query.Get("verb"), query.Get("resource")}
+	if name := query.Get("name"); name != "" {
+		args = append(args, name)
+	}
+	if query.Get("output") != "" {
+		s.render(w, commandWhoCan, args, query)
+		return
+	}
+
+	config, err := s.requestConfig(commandWhoCan, args, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rback := Rback{config: config, permissions: s.rback.permissions}
+	writeJSON(w, rback.whoCan(query.Get("namespace")))
+}
+
+// handleSubjects lists all subjects, e.g. to browse their permissions
+func (s *server) handleSubjects(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, s.rback.subjects())
+}
+
+// handlePermissions returns the effective permissions of a subject, e.g. /api/permissions?kind=sa&namespace=ns1&name=app
+// (for users, the groups they are a member of can be given with the group parameter)
+func (s *server) handlePermissions(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	subject, err := toSubject(query.Get("kind"), query.Get("namespace"), query.Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, s.rback.effectivePermissions(subject, query["group"]))
+}
+
+// handleMetrics exposes the metrics of the snapshot to Prometheus
+func (s *server) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.unfiltered.printMetrics(w)
+}
+
+// handleSubjectAccessReview decides a SubjectAccessReview POSTed to it, e.g. by the API server's webhook authorizer
+func (s *server) handleSubjectAccessReview(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Expected a SubjectAccessReview to be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	var sar SubjectAccessReview
+	if err := json.NewDecoder(req.Body).Decode(&sar); err != nil {
+		http.Error(w, fmt.Sprintf("Can't parse SubjectAccessReview: %v", err), http.StatusBadRequest)
+		return
+	}
+	if sar.Kind != "SubjectAccessReview" {
+		http.Error(w, fmt.Sprintf("Expected kind=SubjectAccessReview, but found %s", sar.Kind), http.StatusBadRequest)
+		return
+	}
+	s.unfiltered.review(&sar)
+	writeJSON(w, sar)
+}
+
+// render writes the output of the command for the request, in the format given by the output parameter
+func (s *server) render(w http.ResponseWriter, cmdName string, args []string, query url.Values) {
+	config, err := s.requestConfig(cmdName, args, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := config.outputFormat
+	if graphFormats[format] != "" {
+		config.outputFormat = ""
+	}
+
+	var output bytes.Buffer
+	rback := Rback{config: config, permissions: s.rback.permissions}
+	err = rback.run(&output)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if contentType := graphFormats[format]; contentType != "" {
+		cmd := exec.Command("dot", "-T"+format)
+		cmd.Stdin = &output
+		image, err := cmd.Output()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Can't render %s with GraphViz: %v", format, err), http.StatusNotImplemented)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(image)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	output.WriteTo(w)
+}
+
+// requestConfig returns the server's config with the command, its arguments and the flags given as query parameters
+func (s *server) requestConfig(cmdName string, args []string, query url.Values) (Config, error) {
+	cmd, _ := findCommand(cmdName)
+	config, values := s.rback.config, s.rback.config.flagValues
+	config.command = cmd.name
+	config.resourceKind, config.resourceNames, config.whoCan = "", nil, WhoCan{}
+
+	fs := newCommandFlagSet(cmd, &config, &values)
+	for _, name := range sortedKeys(toSet(query)) {
+		if contains(requestParameters, name) {
+			continue
+		}
+		if contains(serverOnlyFlags, name) || fs.Lookup(name) == nil {
+			return config, fmt.Errorf("Unsupported parameter %q", name)
+		}
+		for _, value := range query[name] {
+			if err := fs.Set(name, value); err != nil {
+				return config, fmt.Errorf("Invalid value %q for parameter %q: %v", value, name, err)
+			}
+		}
+	}
+	// theme files are only read if given to the server, since requests must not access the server's files
+	if _, builtin := builtinThemes[values.themeName]; !builtin && values.themeName != s.rback.config.flagValues.themeName {
+		return config, fmt.Errorf("Unknown theme %q (supported: %s)", values.themeName, strings.Join(builtinThemeNames(), ", "))
+	}
+
+	if err := cmd.parseArgs(&config, args); err != nil {
+		return config, err
+	}
+	return config, finishConfig(&config, values)
+}
+
+func toSet(query url.Values) map[string]bool {
+	set := map[string]bool{}
+	for key := range query {
+		set[key] = true
+	}
+	return set
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+// WhoCanEntry is a subject that can perform the requested verb on the resource, and the grant that allows it
+type WhoCanEntry struct {
+	Subject string `json:"subject"`
+	Binding string `json:"binding"`
+	Role    string `json:"role"`
+	Scope   string `json:"scope"` // the namespace, or "cluster"
+}
+
+// whoCan returns the subjects that can perform the verb of the who-can config (in the given namespace, if any)
+func (r *Rback) whoCan(namespace string) []WhoCanEntry {
+	entries := []WhoCanEntry{}
+	for ns, bindings := range r.permissions.RoleBindings {
+		if namespace != "" && ns != "" && ns != namespace {
+			continue
+		}
+		for _, binding := range bindings {
+			role, found := r.permissions.Roles[binding.role.namespace][binding.role.name]
+			if !found || !r.config.whoCan.matchesAnyRuleIn(role) {
+				continue
+			}
+			for _, subject := range binding.subjects {
+				entries = append(entries, WhoCanEntry{subjectString(subject), bindingString(binding), roleString(binding.role), scopeString(ns)})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		return a.Subject+a.Binding < b.Subject+b.Binding
+	})
+	return entries
+}
+
+func scopeString(ns string) string {
+	return iff(ns == "", "cluster", ns)
+}
+
+// subjects returns all ServiceAccounts and all subjects referenced by bindings
+func (r *Rback) subjects() []string {
+	subjects := map[string]bool{}
+	for ns, serviceAccounts := range r.permissions.ServiceAccounts {
+		for name := range serviceAccounts {
+			subjects[subjectString(KindNamespacedName{"ServiceAccount", NamespacedName{ns, name}})] = true
+		}
+	}
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			for _, subject := range binding.subjects {
+				subjects[subjectString(subject)] = true
+			}
+		}
+	}
+	return sortedKeys(subjects)
+}
+
+func toSubject(kind, namespace, name string) (KindNamespacedName, error) {
+	subjectKinds := map[string]string{kindServiceAccount: "ServiceAccount", kindUser: "User", kindGroup: "Group"}
+	subjectKind, found := subjectKinds[normalizeKind(kind)]
+	if !found || name == "" || (subjectKind == "ServiceAccount" && namespace == "") {
+		return KindNamespacedName{}, fmt.Errorf("Expected kind (sa, user or group), name and, for ServiceAccounts, namespace")
+	}
+	if subjectKind != "ServiceAccount" {
+		namespace = ""
+	}
+	return KindNamespacedName{subjectKind, NamespacedName{namespace, name}}, nil
+}
+
+// SubjectPermissions are the rules granted to a subject, directly or through the groups it's a member of
+type SubjectPermissions struct {
+	Subject string        `json:"subject"`
+	Groups  []string      `json:"groups,omitempty"`
+	Grants  []GrantReport `json:"grants"`
+}
+
+type GrantReport struct {
+	Binding string       `json:"binding"`
+	Role    string       `json:"role"`
+	Scope   string       `json:"scope"`         // the namespace, or "cluster"
+	Via     string       `json:"via,omitempty"` // the group the grant applies to, if it doesn't apply to the subject directly
+	Rules   []RuleReport `json:"rules"`
+}
+
+type RuleReport struct {
+	Verbs           []string `json:"verbs"`
+	APIGroups       []string `json:"apiGroups,omitempty"`
+	Resources       []string `json:"resources,omitempty"`
+	ResourceNames   []string `json:"resourceNames,omitempty"`
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty"`
+}
+
+// effectivePermissions returns the grants of the subject and of the groups it's a member of: the given groups and
+// the groups Kubernetes assigns implicitly (system:authenticated, and system:serviceaccounts[:NAMESPACE] for
+// ServiceAccounts)
+func (r *Rback) effectivePermissions(subject KindNamespacedName, groups []string) SubjectPermissions {
+	groups = append(groups, implicitGroups(subject)...)
+
+	permissions := SubjectPermissions{Subject: subjectString(subject), Groups: groups, Grants: []GrantReport{}}
+	addGrants := func(grants []Grant, via string) {
+		for _, grant := range grants {
+			rules := grant.role.rules
+			if !r.config.rawRules {
+				rules = normalizeRules(rules)
+			}
+			report := GrantReport{bindingString(grant.binding), roleString(grant.role.NamespacedName), scopeString(grant.scope()), via, []RuleReport{}}
+			for _, rule := range rules {
+				report.Rules = append(report.Rules, RuleReport{rule.verbs, rule.apiGroups, rule.resources, rule.resourceNames, rule.nonResourceURLs})
+			}
+			permissions.Grants = append(permissions.Grants, report)
+		}
+	}
+	addGrants(r.grantsFor(subject), "")
+	for _, group := range groups {
+		addGrants(r.grantsFor(KindNamespacedName{"Group", NamespacedName{"", group}}), group)
+	}
+
+	sort.SliceStable(permissions.Grants, func(i, j int) bool {
+		return permissions.Grants[i].Binding < permissions.Grants[j].Binding
+	})
+	return permissions
+}
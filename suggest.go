@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// auditEvent contains the fields of an audit.k8s.io/v1 Event that are relevant for suggesting roles
+type auditEvent struct {
+	Stage string `json:"stage"`
+	Verb  string `json:"verb"`
+	User  struct {
+		Username string   `json:"username"`
+		Groups   []string `json:"groups"`
+	} `json:"user"`
+	ObjectRef *struct {
+		Resource    string `json:"resource"`
+		Subresource string `json:"subresource"`
+		Namespace   string `json:"namespace"`
+		Name        string `json:"name"`
+		APIGroup    string `json:"apiGroup"`
+	} `json:"objectRef"`
+	RequestURI     string `json:"requestURI"`
+	ResponseStatus *struct {
+		Code int `json:"code"`
+	} `json:"responseStatus"`
+}
+
+// access is a single request a subject actually made
+type access struct {
+	verb           string
+	namespace      string
+	apiGroup       string
+	resource       string // "resource" or "resource/subresource"
+	name           string
+	nonResourceURL string
+}
+
+func (a access) allowedBy(rule Rule) bool {
+	if a.nonResourceURL != "" {
+		return rule.allowsNonResourceURL(a.verb, a.nonResourceURL)
+	}
+	return rule.allows(a.verb, a.apiGroup, a.resource, a.name)
+}
+
+// readAuditLog aggregates the accesses and the groups (as authenticated by the API server) per subject from a file
+// containing audit events as JSON lines
+func (r *Rback) readAuditLog(reader io.Reader) (map[KindNamespacedName]map[access]bool, map[KindNamespacedName]map[string]bool, error) {
+	accesses := map[KindNamespacedName]map[access]bool{}
+	groups := map[KindNamespacedName]map[string]bool{}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var event auditEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			return nil, nil, fmt.Errorf("Can't parse audit event on line %d: %v", lineNo, err)
+		}
+		if event.Stage != "" && event.Stage != "ResponseComplete" {
+			continue // every request is logged in multiple stages
+		}
+		if event.ResponseStatus != nil && event.ResponseStatus.Code == 403 {
+			continue // the request was denied, so it doesn't need to be allowed by the suggested role
+		}
+
+		subject := subjectFromUsername(event.User.Username)
+		if subject.kind == "ServiceAccount" && !r.namespaceSelected(subject.namespace) {
+			continue
+		}
+
+		a := access{verb: event.Verb}
+		if event.ObjectRef != nil && event.ObjectRef.Resource != "" {
+			a.namespace = event.ObjectRef.Namespace
+			a.apiGroup = event.ObjectRef.APIGroup
+			a.resource = event.ObjectRef.Resource
+			if event.ObjectRef.Subresource != "" {
+				a.resource += "/" + event.ObjectRef.Subresource
+			}
+			a.name = event.ObjectRef.Name
+		} else {
+			a.nonResourceURL = strings.SplitN(event.RequestURI, "?", 2)[0]
+		}
+
+		if accesses[subject] == nil {
+			accesses[subject] = map[access]bool{}
+			groups[subject] = map[string]bool{}
+		}
+		accesses[subject][a] = true
+		for _, group := range event.User.Groups {
+			groups[subject][group] = true
+		}
+	}
+	return accesses, groups, scanner.Err()
+}
+
+// subjectFromUsername turns "system:serviceaccount:NAMESPACE:NAME" into a ServiceAccount subject and anything else into a User subject
+func subjectFromUsername(username string) KindNamespacedName {
+	parts := strings.Split(username, ":")
+	if len(parts) == 4 && parts[0] == "system" && parts[1] == "serviceaccount" {
+		return KindNamespacedName{"ServiceAccount", NamespacedName{parts[2], parts[3]}}
+	}
+	return KindNamespacedName{"User", NamespacedName{"", username}}
+}
+
+type roleYAML struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace,omitempty"`
+	} `yaml:"metadata"`
+	Rules []ruleYAML `yaml:"rules"`
+}
+
+type ruleYAML struct {
+	APIGroups       []string `yaml:"apiGroups,omitempty"`
+	Resources       []string `yaml:"resources,omitempty"`
+	ResourceNames   []string `yaml:"resourceNames,omitempty"`
+	NonResourceURLs []string `yaml:"nonResourceURLs,omitempty"`
+	Verbs           []string `yaml:"verbs"`
+}
+
+// printSuggestions prints a least-privilege (Cluster)Role per subject found in the audit log, followed by
+// the rules granted to the subject (directly or through its groups), which the subject didn't use
+func (r *Rback) printSuggestions(w io.Writer) error {
+	file, err := os.Open(r.config.auditLogFile)
+	if err != nil {
+		return fmt.Errorf("Can't open audit log %s: %v", r.config.auditLogFile, err)
+	}
+	defer file.Close()
+
+	accesses, groups, err := r.readAuditLog(file)
+	if err != nil {
+		return err
+	}
+
+	subjects := []KindNamespacedName{}
+	for subject := range accesses {
+		subjects = append(subjects, subject)
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		return subjectString(subjects[i]) < subjectString(subjects[j])
+	})
+
+	for _, subject := range subjects {
+		fmt.Fprintf(w, "# Least-privilege access for %s\n", subjectString(subject))
+		for _, role := range suggestRoles(subject, accesses[subject]) {
+			out, err := yaml.Marshal(role)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "---\n%s", out)
+		}
+
+		unused := r.unusedGrants(subject, setToSlice(groups[subject]), accesses[subject])
+		if len(unused) > 0 {
+			fmt.Fprintf(w, "# Unused permissions granted to %s:\n", subjectString(subject))
+			for _, line := range unused {
+				fmt.Fprintf(w, "#   %s\n", line)
+			}
+		}
+	}
+	return nil
+}
+
+// suggestRoles returns a Role for every namespace the subject accessed and a ClusterRole for all cluster-wide accesses
+func suggestRoles(subject KindNamespacedName, accesses map[access]bool) []roleYAML {
+	byScope := map[string][]access{}
+	for a := range accesses {
+		byScope[a.namespace] = append(byScope[a.namespace], a)
+	}
+
+	scopes := []string{}
+	for scope := range byScope {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	roles := []roleYAML{}
+	for _, scope := range scopes {
+		role := roleYAML{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"}
+		if scope == "" {
+			role.Kind = "ClusterRole"
+		}
+		role.Metadata.Name = suggestedRoleName(subject)
+		role.Metadata.Namespace = scope
+		role.Rules = compactAccesses(byScope[scope])
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// compactAccesses turns the accesses into rules, merging all resources of an API group that were accessed with the same
+// verbs; if every access of a resource with a verb named an object, the verb is restricted to the names of these objects
+func compactAccesses(accesses []access) []ruleYAML {
+	namesByVerb := map[[3]string]map[string]bool{} // [apiGroup, resource, verb] -> names ("" for accesses without one)
+	verbsByURL := map[string]map[string]bool{}
+	for _, a := range accesses {
+		if a.nonResourceURL != "" {
+			if verbsByURL[a.nonResourceURL] == nil {
+				verbsByURL[a.nonResourceURL] = map[string]bool{}
+			}
+			verbsByURL[a.nonResourceURL][a.verb] = true
+		} else {
+			key := [3]string{a.apiGroup, a.resource, a.verb}
+			if namesByVerb[key] == nil {
+				namesByVerb[key] = map[string]bool{}
+			}
+			namesByVerb[key][a.name] = true
+		}
+	}
+
+	verbsByResource := map[[3]string]map[string]bool{} // [apiGroup, resource, comma-separated names or ""] -> verbs
+	for key, names := range namesByVerb {
+		resourceNames := ""
+		if !names[""] {
+			sortedNames := setToSlice(names)
+			sort.Strings(sortedNames)
+			resourceNames = strings.Join(sortedNames, ",")
+		}
+		resourceKey := [3]string{key[0], key[1], resourceNames}
+		if verbsByResource[resourceKey] == nil {
+			verbsByResource[resourceKey] = map[string]bool{}
+		}
+		verbsByResource[resourceKey][key[2]] = true
+	}
+
+	rulesByKey := map[string]*ruleYAML{}
+	for key, verbs := range verbsByResource {
+		sortedVerbs := sortVerbs(setToSlice(verbs))
+		ruleKey := key[0] + "|" + strings.Join(sortedVerbs, ",") + "|" + key[2]
+		if rulesByKey[ruleKey] == nil {
+			rulesByKey[ruleKey] = &ruleYAML{APIGroups: []string{key[0]}, Verbs: sortedVerbs}
+			if key[2] != "" {
+				rulesByKey[ruleKey].ResourceNames = strings.Split(key[2], ",")
+			}
+		}
+		rulesByKey[ruleKey].Resources = append(rulesByKey[ruleKey].Resources, key[1])
+	}
+	for url, verbs := range verbsByURL {
+		sortedVerbs := sortVerbs(setToSlice(verbs))
+		ruleKey := "url|" + strings.Join(sortedVerbs, ",")
+		if rulesByKey[ruleKey] == nil {
+			rulesByKey[ruleKey] = &ruleYAML{Verbs: sortedVerbs}
+		}
+		rulesByKey[ruleKey].NonResourceURLs = append(rulesByKey[ruleKey].NonResourceURLs, url)
+	}
+
+	keys := []string{}
+	for key := range rulesByKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rules := []ruleYAML{}
+	for _, key := range keys {
+		rule := rulesByKey[key]
+		sort.Strings(rule.Resources)
+		sort.Strings(rule.NonResourceURLs)
+		rules = append(rules, *rule)
+	}
+	return rules
+}
+
+// unusedGrants describes the rules (or verbs within rules) granted to the subject (or to the groups it's a member of)
+// that weren't used in any of the accesses
+func (r *Rback) unusedGrants(subject KindNamespacedName, groups []string, accesses map[access]bool) []string {
+	unused := []string{}
+	for _, grant := range r.effectiveGrantsFor(subject, groups) {
+		for _, rule := range grant.role.rules {
+			usedVerbs := map[string]bool{}
+			for a := range accesses {
+				inScope := grant.scope() == "" || grant.scope() == a.namespace
+				if inScope && a.allowedBy(rule) {
+					usedVerbs[a.verb] = true
+				}
+			}
+
+			description := fmt.Sprintf("%s -> %s: ", grantString(grant), rule.toHumanReadableString())
+			if len(usedVerbs) == 0 {
+				unused = append(unused, description+"unused")
+			} else if !contains(rule.verbs, "*") {
+				unusedVerbs := []string{}
+				for _, verb := range rule.verbs {
+					if !usedVerbs[verb] {
+						unusedVerbs = append(unusedVerbs, verb)
+					}
+				}
+				if len(unusedVerbs) > 0 {
+					unused = append(unused, description+"unused verbs "+strings.Join(unusedVerbs, ","))
+				}
+			}
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+func grantString(grant Grant) string {
+	return bindingString(grant.binding) + " -> " + roleString(grant.role.NamespacedName)
+}
+
+func subjectString(subject KindNamespacedName) string {
+	return subject.kind + " " + qualifiedName(subject.namespace, subject.name)
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+func suggestedRoleName(subject KindNamespacedName) string {
+	return strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(subject.name), "-"), "-.") + "-suggested"
+}
+
+// canonicalVerbs defines the order in which verbs are usually listed in rules
+var canonicalVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}
+
+// sortVerbs sorts the verbs in canonical order, followed by any other verbs in alphabetical order
+func sortVerbs(verbs []string) []string {
+	rank := func(verb string) int {
+		for i, v := range canonicalVerbs {
+			if v == verb {
+				return i
+			}
+		}
+		return len(canonicalVerbs)
+	}
+	sort.Slice(verbs, func(i, j int) bool {
+		ri, rj := rank(verbs[i]), rank(verbs[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return verbs[i] < verbs[j]
+	})
+	return verbs
+}
+
+func setToSlice(set map[string]bool) []string {
+	result := []string{}
+	for v := range set {
+		result = append(result, v)
+	}
+	return result
+}
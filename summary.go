@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/dot"
+)
+
+// renderedNode describes a node drawn by genGraph
+type renderedNode struct {
+	kind      string
+	namespace string // the namespace whose subgraph the node is drawn in ("" for the top level)
+	name      string
+	exists    bool
+	focused   bool
+}
+
+// renderedKindTitles are the kinds of the nodes drawn by genGraph as used in Kubernetes
+var renderedKindTitles = map[string]string{
+	kindServiceAccount:     "ServiceAccount",
+	kindUser:               "User",
+	kindGroup:              "Group",
+	kindRoleBinding:        "RoleBinding",
+	kindClusterRoleBinding: "ClusterRoleBinding",
+	kindRole:               "Role",
+	kindClusterRole:        "ClusterRole",
+	kindSecret:             "Secret",
+	kindNamespace:          "Namespace",
+	kindRule:               "Rules",
+	"pod":                  "Pod",
+	"replicaset":           "ReplicaSet",
+	"deployment":           "Deployment",
+	"statefulset":          "StatefulSet",
+	"daemonset":            "DaemonSet",
+	"job":                  "Job",
+	"cronjob":              "CronJob",
+}
+
+// title returns the kind of the node as used in Kubernetes, e.g. "ServiceAccount", or e.g. "ServiceAccounts" for
+// collapsed subjects
+func (node renderedNode) title() string {
+	if strings.HasPrefix(node.kind, "collapsed-") {
+		return strings.TrimPrefix(node.kind, "collapsed-") + "s"
+	}
+	if title, found := renderedKindTitles[node.kind]; found {
+		return title
+	}
+	return node.kind
+}
+
+// renderedRule is a line of a rules node drawn by genGraph
+type renderedRule struct {
+	text    string
+	matches bool // whether the rule matches who-can (and is thus highlighted)
+}
+
+// renderedRules returns the rules listed by the rules node with the given ID; like in the DOT output, consecutive
+// rules that aren't shown because of --show-matched-rules-only are replaced by a single "..."
+func (r *Rback) renderedRules(id string, node renderedNode) []renderedRule {
+	roleRef := NamespacedName{node.namespace, node.name}
+	if strings.HasPrefix(id, kindRule+"-"+kindClusterRole+":") {
+		roleRef.namespace = "" // a ClusterRole drawn in the namespace of a RoleBinding
+	}
+	rules := r.permissions.Roles[roleRef.namespace][roleRef.name].rules
+	if !r.config.rawRules {
+		rules = normalizeRules(rules)
+	}
+
+	lines := []renderedRule{}
+	for _, rule := range rules {
+		if r.config.resourceKind == kindRule && node.focused && r.config.whoCan.matches(rule) {
+			lines = append(lines, renderedRule{rule.toHumanReadableString(), true})
+		} else if !r.config.whoCan.showMatchedOnly {
+			lines = append(lines, renderedRule{rule.toHumanReadableString(), false})
+		} else if len(lines) == 0 || lines[len(lines)-1].text != "..." {
+			lines = append(lines, renderedRule{"...", false})
+		}
+	}
+	return lines
+}
+
+func (r *Rback) recordNode(id, kind, namespace, name string, exists, focused bool) {
+	r.renderedNodes[id] = renderedNode{kind, namespace, name, exists, focused}
+}
+
+// types of the edges drawn by genGraph
+const (
+	edgeBoundBy          = "bound-by"  // from a subject to a binding
+	edgeGrants           = "grants"    // from a binding to a role
+	edgeHasRules         = "has-rules" // from a role to its rules
+	edgeRunsAs           = "runs-as"   // from a workload to its ServiceAccount
+	edgeReferencesSecret = "references-secret"
+	edgeImagePullSecret  = "image-pull-secret"
+)
+
+// renderedEdge describes an edge drawn by genGraph, between the IDs of the nodes
+type renderedEdge struct {
+	from, to, edgeType string
+}
+
+// graphNode is a node drawn by genGraph together with its ID, which the dot package doesn't expose
+type graphNode struct {
+	dot.Node
+	id string
+}
+
+func (r *Rback) recordEdge(from, to graphNode, edgeType string) {
+	r.renderedEdges[renderedEdge{from.id, to.id, edgeType}] = true
+}
+
+func (r *Rback) newNamespaceSummaryNode(g *dot.Graph, ns string) graphNode {
+	counts := []string{
+		pluralize(len(r.permissions.ServiceAccounts[ns]), "ServiceAccount"),
+		pluralize(len(r.permissions.Roles[ns]), "Role"),
+		pluralize(len(r.permissions.RoleBindings[ns]), "RoleBinding"),
+	}
+	workloads := 0
+	for _, workload := range r.permissions.Workloads[ns] {
+		if !r.isControlledByKnownWorkload(workload) {
+			workloads++
+		}
+	}
+	if workloads > 0 {
+		counts = append(counts, pluralize(workloads, "Workload"))
+	}
+
+	namespace, exists := r.permissions.Namespaces[ns]
+	phase := namespace.phase
+	if !exists && len(r.permissions.Namespaces) > 0 {
+		phase = phaseMissing
+	}
+	id := nodeID(kindNamespace, "", ns)
+	r.recordNode(id, kindNamespace, "", ns, phase != phaseMissing, false)
+	node := r.newNamespaceSummaryNode0(g, ns, counts, phase)
+	if exists {
+		r.addDetails(node.AttributesMap, "Namespace", "", ns, true, namespaceTooltip(namespace))
+	}
+	return graphNode{node, id}
+}
+
+func (r *Rback) newCollapsedSubjectsNode(gns *dot.Graph, binding Binding, kind string, subjects []KindNamespacedName) graphNode {
+	id := nodeID("collapsed-"+kind, binding.namespace, binding.name)
+	r.recordNode(id, "collapsed-"+kind, binding.namespace, fmt.Sprintf("%d %ss", len(subjects), kind), true, false)
+	node := r.newCollapsedSubjectsNode0(gns, id, kind, len(subjects))
+
+	tooltip := []string{}
+	for _, subject := range subjects {
+		tooltip = append(tooltip, subjectString(subject))
+	}
+	sort.Strings(tooltip)
+	r.addDetails(node.AttributesMap, kind, "", "", false, tooltip)
+	return graphNode{node, id}
+}
+
+func pluralize(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, noun)
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+// allNamespaceNames returns the names of all namespaces that contain or are referenced by RBAC resources or workloads
+func (r *Rback) allNamespaceNames() []string {
+	names := map[string]bool{}
+	for ns := range r.permissions.ServiceAccounts {
+		names[ns] = true
+	}
+	for ns := range r.permissions.Roles {
+		names[ns] = true
+	}
+	for ns, bindings := range r.permissions.RoleBindings {
+		names[ns] = true
+		for _, binding := range bindings {
+			for _, subject := range binding.subjects {
+				if subject.kind == "ServiceAccount" {
+					names[subject.namespace] = true
+				}
+			}
+		}
+	}
+	for ns := range r.permissions.Workloads {
+		names[ns] = true
+	}
+	for ns := range r.permissions.Namespaces {
+		names[ns] = true
+	}
+	delete(names, "")
+
+	result := []string{}
+	for ns := range names {
+		result = append(result, ns)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// namespaceContainsFocus returns true if the focused resource (if any) lives in the given namespace
+func (r *Rback) namespaceContainsFocus(ns string) bool {
+	if !r.namespaceSelected(ns) {
+		return false
+	}
+	switch r.config.resourceKind {
+	case kindServiceAccount:
+		for name := range r.permissions.ServiceAccounts[ns] {
+			if r.resourceNameSelected(name) {
+				return true
+			}
+		}
+	case kindRole:
+		for name := range r.permissions.Roles[ns] {
+			if r.resourceNameSelected(name) {
+				return true
+			}
+		}
+	case kindRoleBinding:
+		for name := range r.permissions.RoleBindings[ns] {
+			if r.resourceNameSelected(name) {
+				return true
+			}
+		}
+	case kindRule:
+		for name := range r.permissions.Roles[ns] {
+			if r.ruleMatchesSelection(NamespacedName{ns, name}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fitIntoNodeBudget progressively collapses the least relevant parts of the graph until it has at most
+// --max-nodes nodes: first the subjects of bindings, then the secrets, workloads and access rules, and finally
+// the namespaces not containing the focused resource, starting with the largest ones
+func (r *Rback) fitIntoNodeBudget(g *dot.Graph) *dot.Graph {
+	// the collapse settings are changed on a copy, so that the caller's config stays as given
+	reduced := *r
+	defer func() {
+		r.collapsedNamespaces, r.renderedNodes, r.renderedEdges = reduced.collapsedNamespaces, reduced.renderedNodes, reduced.renderedEdges
+	}()
+
+	overBudget := func() bool {
+		return len(reduced.renderedNodes) > reduced.config.maxNodes
+	}
+
+	for _, threshold := range []int{10, 3, 1} {
+		if !overBudget() {
+			return g
+		}
+		if reduced.config.collapseSubjects == 0 || reduced.config.collapseSubjects > threshold {
+			reduced.config.collapseSubjects = threshold
+			g = reduced.genGraph0()
+		}
+	}
+
+	if overBudget() && reduced.config.showSecrets {
+		reduced.config.showSecrets = false
+		g = reduced.genGraph0()
+	}
+	if overBudget() && reduced.config.showWorkloads {
+		reduced.config.showWorkloads = false
+		g = reduced.genGraph0()
+	}
+	if overBudget() && reduced.config.showRules {
+		reduced.config.showRules = false
+		g = reduced.genGraph0()
+	}
+
+	for overBudget() {
+		nodesPerNamespace := map[string]int{}
+		for _, node := range reduced.renderedNodes {
+			if node.namespace != "" && !reduced.collapsedNamespaces[node.namespace] && !reduced.namespaceContainsFocus(node.namespace) {
+				nodesPerNamespace[node.namespace]++
+			}
+		}
+		if len(nodesPerNamespace) == 0 {
+			fmt.Fprintf(os.Stderr, "Can't reduce the graph to %d nodes, it still has %d nodes\n", reduced.config.maxNodes, len(reduced.renderedNodes))
+			return g
+		}
+
+		namespaces := []string{}
+		for ns := range nodesPerNamespace {
+			namespaces = append(namespaces, ns)
+		}
+		sort.Slice(namespaces, func(i, j int) bool {
+			a, b := namespaces[i], namespaces[j]
+			return nodesPerNamespace[a] > nodesPerNamespace[b] || (nodesPerNamespace[a] == nodesPerNamespace[b] && a < b)
+		})
+
+		// collapse just enough namespaces to (probably) get below the budget, then redraw and check again
+		excess := len(reduced.renderedNodes) - reduced.config.maxNodes
+		for _, ns := range namespaces {
+			reduced.collapsedNamespaces[ns] = true
+			excess -= nodesPerNamespace[ns] - 1
+			if excess <= 0 {
+				break
+			}
+		}
+		g = reduced.genGraph0()
+	}
+	return g
+}
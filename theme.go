@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/dot"
+	"gopkg.in/yaml.v2"
+)
+
+// Theme controls how graphs are rendered, e.g.:
+//
+//	base: dark
+//	rankdir: LR
+//	fontname: Helvetica
+//	nodes:
+//	  subject: {fillcolor: "#005f87"}
+//	  rules: {shape: box}
+//	highlight: {penwidth: "3.0", color: "#ff00ff"}
+//
+// Fields not set in a theme file are taken from the base theme (default, if not set).
+type Theme struct {
+	Base       string `yaml:"base"`
+	RankDir    string `yaml:"rankdir"`
+	FontName   string `yaml:"fontname"`
+	FontColor  string `yaml:"fontcolor"` // used for namespace labels
+	Background string `yaml:"background"`
+	EdgeColor  string `yaml:"edgecolor"`
+
+	Nodes map[string]NodeStyle `yaml:"nodes"` // see themeNodeKinds for the keys
+
+	Namespace            NodeStyle `yaml:"namespace"`
+	MissingNamespace     NodeStyle `yaml:"missingNamespace"`
+	TerminatingNamespace NodeStyle `yaml:"terminatingNamespace"`
+
+	Missing   NodeStyle `yaml:"missing"` // applied on top of the node style for objects that are referenced, but don't exist
+	Highlight NodeStyle `yaml:"highlight"`
+}
+
+// NodeStyle contains the graphviz attributes of a node (or cluster); empty attributes aren't set
+type NodeStyle struct {
+	Shape     string `yaml:"shape"`
+	Style     string `yaml:"style"`
+	Color     string `yaml:"color"`
+	FillColor string `yaml:"fillcolor"`
+	FontColor string `yaml:"fontcolor"`
+	PenWidth  string `yaml:"penwidth"`
+}
+
+const (
+	themeSubject            = "subject"
+	themeWorkload           = "workload"
+	themeRoleBinding        = "rolebinding"
+	themeClusterRoleBinding = "clusterrolebinding"
+	themeRole               = "role"
+	themeClusterRole        = "clusterrole"
+	themeRules              = "rules"
+	themeNamespaceSummary   = "namespace"
+	themeSecret             = "secret"
+	themeLegacyTokenSecret  = "legacytokensecret"
+)
+
+var themeNodeKinds = []string{themeSubject, themeWorkload, themeRoleBinding, themeClusterRoleBinding, themeRole, themeClusterRole, themeRules, themeNamespaceSummary, themeSecret, themeLegacyTokenSecret}
+
+var builtinThemes = map[string]Theme{
+	"default": {
+		Nodes: map[string]NodeStyle{
+			themeSubject:            {Shape: "box", Color: "black", FillColor: "#2f6de1", FontColor: "#f0f0f0", PenWidth: "1.0"},
+			themeWorkload:           {Shape: "component", FillColor: "#84c33d", FontColor: "#030303"},
+			themeRoleBinding:        {Shape: "octagon", FillColor: "#ffcc00", FontColor: "#030303", PenWidth: "1.0"},
+			themeClusterRoleBinding: {Shape: "doubleoctagon", FillColor: "#ffcc00", FontColor: "#030303", PenWidth: "1.0"},
+			themeRole:               {Shape: "octagon", Color: "black", FillColor: "#ff9900", FontColor: "#030303", PenWidth: "1.0"},
+			themeClusterRole:        {Shape: "doubleoctagon", Color: "black", FillColor: "#ff9900", FontColor: "#030303", PenWidth: "1.0"},
+			themeRules:              {Shape: "note", PenWidth: "1.0"},
+			themeNamespaceSummary:   {Shape: "folder", Color: "black"},
+			themeSecret:             {Shape: "cylinder", Color: "black", FillColor: "#c0c0c0", FontColor: "#030303"},
+			themeLegacyTokenSecret:  {Shape: "cylinder", Color: "black", FillColor: "#e34a33", FontColor: "#f0f0f0"},
+		},
+		MissingNamespace:     NodeStyle{Color: "red", FontColor: "red", FillColor: "#fde0dd"},
+		TerminatingNamespace: NodeStyle{Color: "#ff9900", FillColor: "#fff3cd"},
+		Missing:              NodeStyle{Style: "dotted", Color: "red", FontColor: "#030303", PenWidth: "2.0"},
+		Highlight:            NodeStyle{PenWidth: "2.0"},
+	},
+	"dark": {
+		FontColor:  "#e0e0e0",
+		Background: "#1e1e1e",
+		EdgeColor:  "#b0b0b0",
+		Nodes: map[string]NodeStyle{
+			themeSubject:            {Shape: "box", Color: "#e0e0e0", FillColor: "#1f4fa8", FontColor: "#f0f0f0", PenWidth: "1.0"},
+			themeWorkload:           {Shape: "component", Color: "#e0e0e0", FillColor: "#4f7a22", FontColor: "#f0f0f0"},
+			themeRoleBinding:        {Shape: "octagon", Color: "#e0e0e0", FillColor: "#b38f00", FontColor: "#f0f0f0", PenWidth: "1.0"},
+			themeClusterRoleBinding: {Shape: "doubleoctagon", Color: "#e0e0e0", FillColor: "#b38f00", FontColor: "#f0f0f0", PenWidth: "1.0"},
+			themeRole:               {Shape: "octagon", Color: "#e0e0e0", FillColor: "#b36b00", FontColor: "#f0f0f0", PenWidth: "1.0"},
+			themeClusterRole:        {Shape: "doubleoctagon", Color: "#e0e0e0", FillColor: "#b36b00", FontColor: "#f0f0f0", PenWidth: "1.0"},
+			themeRules:              {Shape: "note", Style: "filled", Color: "#e0e0e0", FillColor: "#2d2d2d", FontColor: "#e0e0e0", PenWidth: "1.0"},
+			themeNamespaceSummary:   {Shape: "folder", Color: "#e0e0e0", FontColor: "#e0e0e0"},
+			themeSecret:             {Shape: "cylinder", Color: "#e0e0e0", FillColor: "#505050", FontColor: "#f0f0f0"},
+			themeLegacyTokenSecret:  {Shape: "cylinder", Color: "#e0e0e0", FillColor: "#a3281a", FontColor: "#f0f0f0"},
+		},
+		Namespace:            NodeStyle{Color: "#808080"},
+		MissingNamespace:     NodeStyle{Color: "#ff6b6b", FontColor: "#ff6b6b", FillColor: "#3d1f1f"},
+		TerminatingNamespace: NodeStyle{Color: "#ffb347", FillColor: "#3d321f"},
+		Missing:              NodeStyle{Style: "dotted", Color: "#ff6b6b", FontColor: "#e0e0e0", PenWidth: "2.0"},
+		Highlight:            NodeStyle{PenWidth: "3.0"},
+	},
+	// colorblind uses the Okabe-Ito palette, and doesn't rely on red/green to tell missing objects apart
+	"colorblind": {
+		Nodes: map[string]NodeStyle{
+			themeSubject:            {Shape: "box", Color: "black", FillColor: "#0072b2", FontColor: "#ffffff", PenWidth: "1.0"},
+			themeWorkload:           {Shape: "component", FillColor: "#009e73", FontColor: "#ffffff"},
+			themeRoleBinding:        {Shape: "octagon", FillColor: "#f0e442", FontColor: "#000000", PenWidth: "1.0"},
+			themeClusterRoleBinding: {Shape: "doubleoctagon", FillColor: "#f0e442", FontColor: "#000000", PenWidth: "1.0"},
+			themeRole:               {Shape: "octagon", Color: "black", FillColor: "#e69f00", FontColor: "#000000", PenWidth: "1.0"},
+			themeClusterRole:        {Shape: "doubleoctagon", Color: "black", FillColor: "#e69f00", FontColor: "#000000", PenWidth: "1.0"},
+			themeRules:              {Shape: "note", PenWidth: "1.0"},
+			themeNamespaceSummary:   {Shape: "folder", Color: "black"},
+			themeSecret:             {Shape: "cylinder", Color: "black", FillColor: "#bbbbbb", FontColor: "#000000"},
+			themeLegacyTokenSecret:  {Shape: "cylinder", Color: "black", FillColor: "#cc79a7", FontColor: "#000000"},
+		},
+		MissingNamespace:     NodeStyle{Color: "#d55e00", FontColor: "#d55e00", FillColor: "#f7e1d3"},
+		TerminatingNamespace: NodeStyle{Color: "#cc79a7", FillColor: "#f5e3ed"},
+		Missing:              NodeStyle{Style: "dashed", Color: "#d55e00", FontColor: "#000000", PenWidth: "3.0"},
+		Highlight:            NodeStyle{PenWidth: "3.0", Color: "#000000"},
+	},
+}
+
+// loadTheme returns the built-in theme with the given name, or the theme defined in the given file
+func loadTheme(nameOrFile string) (Theme, error) {
+	if builtin, found := builtinThemes[nameOrFile]; found {
+		return builtin, nil
+	}
+
+	data, err := ioutil.ReadFile(nameOrFile)
+	if err != nil {
+		return Theme{}, fmt.Errorf("Unknown theme %q (built-in themes: %s) and can't read it as a file: %v", nameOrFile, strings.Join(builtinThemeNames(), ", "), err)
+	}
+	var custom Theme
+	if err := yaml.UnmarshalStrict(data, &custom); err != nil {
+		return Theme{}, fmt.Errorf("Can't parse theme %s: %v", nameOrFile, err)
+	}
+
+	baseName := custom.Base
+	if baseName == "" {
+		baseName = "default"
+	}
+	base, found := builtinThemes[baseName]
+	if !found {
+		return Theme{}, fmt.Errorf("Theme %s: unknown base theme %q (built-in themes: %s)", nameOrFile, baseName, strings.Join(builtinThemeNames(), ", "))
+	}
+	for kind := range custom.Nodes {
+		if !contains(themeNodeKinds, kind) {
+			return Theme{}, fmt.Errorf("Theme %s: unknown node kind %q (supported: %s)", nameOrFile, kind, strings.Join(themeNodeKinds, ", "))
+		}
+	}
+	return base.merge(custom), nil
+}
+
+func builtinThemeNames() []string {
+	names := []string{}
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// merge returns a copy of the theme with all fields that are set in the other theme overridden
+func (t Theme) merge(other Theme) Theme {
+	result := t
+	result.Base = ""
+	result.RankDir = firstNonEmpty(other.RankDir, t.RankDir)
+	result.FontName = firstNonEmpty(other.FontName, t.FontName)
+	result.FontColor = firstNonEmpty(other.FontColor, t.FontColor)
+	result.Background = firstNonEmpty(other.Background, t.Background)
+	result.EdgeColor = firstNonEmpty(other.EdgeColor, t.EdgeColor)
+
+	result.Nodes = map[string]NodeStyle{}
+	for kind, style := range t.Nodes {
+		result.Nodes[kind] = style
+	}
+	for kind, style := range other.Nodes {
+		result.Nodes[kind] = result.Nodes[kind].merge(style)
+	}
+
+	result.Namespace = t.Namespace.merge(other.Namespace)
+	result.MissingNamespace = t.MissingNamespace.merge(other.MissingNamespace)
+	result.TerminatingNamespace = t.TerminatingNamespace.merge(other.TerminatingNamespace)
+	result.Missing = t.Missing.merge(other.Missing)
+	result.Highlight = t.Highlight.merge(other.Highlight)
+	return result
+}
+
+func (s NodeStyle) merge(other NodeStyle) NodeStyle {
+	return NodeStyle{
+		Shape:     firstNonEmpty(other.Shape, s.Shape),
+		Style:     firstNonEmpty(other.Style, s.Style),
+		Color:     firstNonEmpty(other.Color, s.Color),
+		FillColor: firstNonEmpty(other.FillColor, s.FillColor),
+		FontColor: firstNonEmpty(other.FontColor, s.FontColor),
+		PenWidth:  firstNonEmpty(other.PenWidth, s.PenWidth),
+	}
+}
+
+// nodeStyle returns the style for the given kind of node, taking into account whether the object exists and
+// whether it's highlighted
+func (t Theme) nodeStyle(kind string, exists, highlight bool) NodeStyle {
+	style := t.Nodes[kind]
+	if highlight {
+		style = style.merge(t.Highlight)
+	}
+	if !exists {
+		style = style.merge(t.Missing)
+	}
+	return style
+}
+
+// apply sets all (non-empty) attributes of the style, plus the theme's font
+func (t Theme) apply(s NodeStyle, attributes dot.AttributesMap) {
+	setAttr(attributes, "shape", s.Shape)
+	setAttr(attributes, "style", s.Style)
+	setAttr(attributes, "color", s.Color)
+	setAttr(attributes, "fillcolor", s.FillColor)
+	setAttr(attributes, "fontcolor", s.FontColor)
+	setAttr(attributes, "penwidth", s.PenWidth)
+	setAttr(attributes, "fontname", t.FontName)
+}
+
+// applyToGraph sets the graph-wide attributes of the theme
+func (t Theme) applyToGraph(g *dot.Graph) {
+	setAttr(g.AttributesMap, "rankdir", t.RankDir)
+	setAttr(g.AttributesMap, "fontname", t.FontName)
+	setAttr(g.AttributesMap, "fontcolor", t.FontColor)
+	setAttr(g.AttributesMap, "bgcolor", t.Background)
+}
+
+func setAttr(attributes dot.AttributesMap, key, value string) {
+	if value != "" {
+		attributes.Attr(key, value)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// roots of the tree output
+const (
+	treeRootSubject = "subject"
+	treeRootRole    = "role"
+)
+
+// color modes of the tree output
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// ANSI escape codes used by the tree output
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiFaint = "\x1b[2m"
+	ansiRed   = "\x1b[31m"
+	ansiBlue  = "\x1b[34m"
+)
+
+// treeWriter writes the graph drawn by genGraph as an indented tree: per namespace, the subjects with their
+// bindings, roles and rules, or with --tree-root role, the roles with their rules, bindings and subjects
+type treeWriter struct {
+	r        *Rback
+	w        io.Writer
+	color    bool
+	children map[string][]string // by node ID
+}
+
+func (r *Rback) writeTree(w io.Writer) error {
+	r.genGraph()
+	t := treeWriter{r: r, w: w, color: useColor(r.config.color, w), children: map[string][]string{}}
+
+	// the edges are followed in the direction of the tree: workloads are below their ServiceAccounts, and role-centric
+	// trees follow bindings backwards
+	for _, edge := range r.sortedRenderedEdges() {
+		forward := edge.edgeType == edgeHasRules || edge.edgeType == edgeReferencesSecret || edge.edgeType == edgeImagePullSecret
+		if r.config.treeRoot != treeRootRole {
+			forward = forward || edge.edgeType == edgeBoundBy || edge.edgeType == edgeGrants
+		}
+		if forward {
+			t.children[edge.from] = append(t.children[edge.from], edge.to)
+		} else {
+			t.children[edge.to] = append(t.children[edge.to], edge.from)
+		}
+	}
+	for _, children := range t.children {
+		sort.SliceStable(children, func(i, j int) bool {
+			return r.renderedNodes[children[i]].kind == kindRule && r.renderedNodes[children[j]].kind != kindRule
+		})
+	}
+
+	// the roots are the subjects (or roles), followed by anything not reachable from them (e.g. roles that aren't
+	// bound), bindings before roles, so that each node is printed below the nodes it belongs to if possible
+	ids := r.sortedRenderedNodeIDs()
+	sort.SliceStable(ids, func(i, j int) bool {
+		return t.rank(r.renderedNodes[ids[i]]) < t.rank(r.renderedNodes[ids[j]])
+	})
+	reached := map[string]bool{}
+	byNamespace := map[string][]string{}
+	for _, id := range ids {
+		if t.rank(r.renderedNodes[id]) == 0 || !reached[id] {
+			t.markReachable(id, reached)
+			for _, ns := range t.sections(id) {
+				byNamespace[ns] = append(byNamespace[ns], id)
+			}
+		}
+	}
+	namespaces := []string{}
+	for ns := range byNamespace {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for i, ns := range namespaces {
+		if i > 0 {
+			fmt.Fprintln(t.w)
+		}
+		heading := "Cluster"
+		if ns != "" {
+			heading = "Namespace " + ns
+			if phase := r.namespacePhase(ns); phase == phaseMissing || phase == phaseTerminating {
+				heading += " (" + phase + ")"
+			}
+		}
+		fmt.Fprintln(t.w, t.paint(heading, ansiBold+ansiBlue))
+
+		roots := byNamespace[ns]
+		for j, id := range roots {
+			t.writeNode(id, ns, "", j == len(roots)-1, map[string]bool{})
+		}
+	}
+	return nil
+}
+
+// rank orders the kinds of nodes for choosing the roots of the tree; nodes of rank 0 are always roots
+func (t *treeWriter) rank(node renderedNode) int {
+	subject := node.kind == kindServiceAccount || node.kind == kindUser || node.kind == kindGroup || strings.HasPrefix(node.kind, "collapsed-")
+	role := node.kind == kindRole || node.kind == kindClusterRole
+	switch {
+	case node.kind == kindNamespace: // a collapsed namespace
+		return 0
+	case t.r.config.treeRoot == treeRootRole && role, t.r.config.treeRoot != treeRootRole && subject:
+		return 0
+	case node.kind == kindRoleBinding || node.kind == kindClusterRoleBinding:
+		return 1
+	case role, subject:
+		return 2
+	case node.kind == kindRule:
+		return 4
+	}
+	return 3
+}
+
+// sections returns the namespaces of the sections the root is printed in ("" for the cluster): Users and Groups aren't
+// namespaced, so they are printed in the sections of their bindings (the cluster for ClusterRoleBindings), and other
+// nodes in the section of their namespace
+func (t *treeWriter) sections(id string) []string {
+	if !t.sectionedByBindings(t.r.renderedNodes[id]) {
+		return []string{t.r.renderedNodes[id].namespace}
+	}
+	sections := []string{}
+	for _, child := range t.children[id] {
+		if ns := t.r.renderedNodes[child].namespace; !contains(sections, ns) {
+			sections = append(sections, ns)
+		}
+	}
+	if len(sections) == 0 {
+		return []string{""}
+	}
+	return sections
+}
+
+// sectionedByBindings returns true for roots printed with just the bindings of the section, in every section of them
+func (t *treeWriter) sectionedByBindings(node renderedNode) bool {
+	return t.r.config.treeRoot != treeRootRole && node.namespace == "" && (node.kind == kindUser || node.kind == kindGroup)
+}
+
+// markReachable marks the node and all its descendants as reached
+func (t *treeWriter) markReachable(id string, reached map[string]bool) {
+	if reached[id] {
+		return
+	}
+	reached[id] = true
+	for _, child := range t.children[id] {
+		t.markReachable(child, reached)
+	}
+}
+
+// writeNode writes the node and its children in the section of the namespace ns ("" for the cluster)
+func (t *treeWriter) writeNode(id, ns, prefix string, last bool, ancestors map[string]bool) {
+	node := t.r.renderedNodes[id]
+	branch, indent := "├── ", "│   "
+	if last {
+		branch, indent = "└── ", "    "
+	}
+
+	if node.kind == kindRule {
+		rules := t.r.renderedRules(id, node)
+		for i, rule := range rules {
+			if i == len(rules)-1 {
+				branch = iff(last, "└── ", "├── ")
+			} else {
+				branch = "├── "
+			}
+			fmt.Fprintln(t.w, prefix+branch+t.ruleLine(rule))
+		}
+		return
+	}
+
+	fmt.Fprintln(t.w, prefix+branch+t.nodeLine(node, ns))
+	root := len(ancestors) == 0
+	if !root && t.rank(node) == 0 {
+		return // a root (e.g. a collapsed namespace) is only expanded as such
+	}
+	ancestors[id] = true
+	defer delete(ancestors, id)
+	children := []string{}
+	for _, child := range t.children[id] {
+		if ancestors[child] || (root && t.sectionedByBindings(node) && t.r.renderedNodes[child].namespace != ns) {
+			continue
+		}
+		children = append(children, child)
+	}
+	for i, child := range children {
+		t.writeNode(child, ns, prefix+indent, i == len(children)-1, ancestors)
+	}
+}
+
+// nodeLine describes the node, e.g. "RoleBinding read-pods", or "RoleBinding team-a/read-pods" if it's in another
+// namespace than the section ns; missing and (without colors) focused nodes are marked
+func (t *treeWriter) nodeLine(node renderedNode, ns string) string {
+	name := node.name
+	if node.namespace != ns && node.kind != kindClusterRole { // ClusterRoles bound by RoleBindings are drawn in their namespace
+		name = qualifiedName(node.namespace, node.name)
+	}
+	line := t.paint(node.title(), ansiFaint) + " " + t.paint(name, iff(node.focused, ansiBold, ""))
+	if !node.exists {
+		line += " " + t.paint("(missing)", ansiRed)
+	}
+	if node.focused && !t.color {
+		line += " (focused)"
+	}
+	return line
+}
+
+// ruleLine describes the rule; rules matching who-can are bold, or marked without colors
+func (t *treeWriter) ruleLine(rule renderedRule) string {
+	if !rule.matches {
+		return rule.text
+	}
+	if t.color {
+		return t.paint(rule.text, ansiBold)
+	}
+	return rule.text + " (matches)"
+}
+
+func (t *treeWriter) paint(text, codes string) string {
+	if !t.color || codes == "" {
+		return text
+	}
+	return codes + text + ansiReset
+}
+
+// useColor returns whether to color the output: with "auto", only if it's written to a terminal and $NO_COLOR isn't set
+func useColor(mode string, w io.Writer) bool {
+	switch mode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, isFile := w.(*os.File)
+	if !isFile {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -4,17 +4,54 @@ type Permissions struct {
 	ServiceAccounts map[string]map[string]string  // map[namespace]map[name]json
 	Roles           map[string]map[string]Role    // ClusterRoles are stored in Roles[""]
 	RoleBindings    map[string]map[string]Binding // ClusterRoleBindings are stored in RoleBindings[""]
+	Workloads       map[string][]Workload         // map[namespace][]workload
+	Namespaces      map[string]Namespace          // only filled if Namespace objects were part of the input
+	Secrets         map[string]map[string]Secret  // only filled if Secret objects were part of the input
+}
+
+type Namespace struct {
+	name string
+	ObjectMeta
+	phase string // Active or Terminating
+}
+
+// ObjectMeta contains the metadata of an object that is shown in tooltips (and used by selectors)
+type ObjectMeta struct {
+	labels      map[string]string
+	annotations map[string]string
+	created     string // the creationTimestamp, if any
 }
 
 type Binding struct {
 	NamespacedName
-	role     NamespacedName
-	subjects []KindNamespacedName
+	role            NamespacedName
+	subjects        []KindNamespacedName
+	ignoredSubjects int // number of subjects not stored in subjects, because they matched an ignored prefix
+	ObjectMeta
+}
+
+// Workload is a Pod or a controller with a pod template (Deployment, DaemonSet, CronJob, ...)
+type Workload struct {
+	kind string
+	NamespacedName
+	serviceAccountName           string
+	automountServiceAccountToken *bool               // nil if not set in the pod spec
+	controller                   *KindNamespacedName // the controlling owner (e.g. the ReplicaSet of a Pod), if any
+	ObjectMeta
+}
+
+// Secret contains the metadata of a Secret; its data is never stored
+type Secret struct {
+	NamespacedName
+	secretType         string
+	serviceAccountName string // the ServiceAccount a (legacy) token Secret belongs to, if any
+	ObjectMeta
 }
 
 type Role struct {
 	NamespacedName
 	rules []Rule
+	ObjectMeta
 }
 
 type NamespacedName struct {
@@ -0,0 +1,147 @@
+package main
+
+// uiHTML is the web UI of serve; it only uses the REST API and renders graphs as SVG (falling back to the DOT
+// source if GraphViz isn't installed on the server)
+const uiHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rback</title>
+<style>
+  body { margin: 0; display: flex; height: 100vh; font: 14px sans-serif; }
+  nav { width: 320px; padding: 12px; overflow-y: auto; background: #f4f4f4; border-right: 1px solid #ddd; }
+  main { flex: 1; padding: 12px; overflow: auto; }
+  h1 { font-size: 20px; margin: 0 0 8px; }
+  fieldset { margin: 0 0 12px; border: 1px solid #ccc; }
+  label { display: block; margin: 4px 0; }
+  input[type=text], select { width: 100%; box-sizing: border-box; }
+  table { border-collapse: collapse; }
+  td, th { border: 1px solid #ddd; padding: 2px 6px; text-align: left; vertical-align: top; }
+  .error { color: #b00; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<nav>
+  <h1>rback</h1>
+  <form id="graph">
+    <fieldset><legend>Graph</legend>
+      <label>Kind <select name="kind">
+        <option value="">all</option><option value="sa">ServiceAccounts</option><option value="user">Users</option>
+        <option value="group">Groups</option><option value="rb">RoleBindings</option><option value="crb">ClusterRoleBindings</option>
+        <option value="r">Roles</option><option value="cr">ClusterRoles</option></select></label>
+      <label>Names (space-delimited) <input type="text" name="name"></label>
+      <label>Namespaces <input type="text" name="n" placeholder="team-*,!kube-*"></label>
+      <label>Label selector <input type="text" name="selector"></label>
+      <label><input type="checkbox" name="show-rules" checked> Rules</label>
+      <label><input type="checkbox" name="show-workloads" checked> Workloads</label>
+      <label><input type="checkbox" name="show-secrets"> Secrets</label>
+      <label><input type="checkbox" name="show-legend" checked> Legend</label>
+      <label>Theme <select name="theme"><option>default</option><option>dark</option><option>colorblind</option></select></label>
+      <button>Render</button>
+    </fieldset>
+  </form>
+  <form id="who-can">
+    <fieldset><legend>Who can</legend>
+      <label>Verb <input type="text" name="verb" value="get"></label>
+      <label>Resource <input type="text" name="resource" value="secrets"></label>
+      <label>Name (optional) <input type="text" name="name"></label>
+      <label>Namespace (optional) <input type="text" name="namespace"></label>
+      <button>List</button> <button name="render">Render</button>
+    </fieldset>
+  </form>
+  <form id="permissions">
+    <fieldset><legend>Effective permissions</legend>
+      <label>Subject <select name="subject"></select></label>
+      <button>Show</button>
+    </fieldset>
+  </form>
+</nav>
+<main id="result">Select what to show on the left.</main>
+<script>
+const result = document.getElementById('result');
+
+function escapeHTML(s) {
+  return String(s).replace(/[&<>"]/g, c => ({'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;'})[c]);
+}
+
+async function get(url) {
+  const response = await fetch(url);
+  const text = await response.text();
+  if (!response.ok) throw new Error(text);
+  return text;
+}
+
+async function show(render) {
+  result.textContent = 'Loading...';
+  try {
+    await render();
+  } catch (e) {
+    result.innerHTML = '<p class="error">' + escapeHTML(e.message) + '</p>';
+  }
+}
+
+async function showGraph(url, params) {
+  params.set('output', 'svg');
+  try {
+    result.innerHTML = await get(url + '?' + params);
+  } catch (e) {
+    params.set('output', 'dot');
+    const dot = await get(url + '?' + params);
+    result.innerHTML = '<p class="error">' + escapeHTML(e.message) + '</p><pre>' + escapeHTML(dot) + '</pre>';
+  }
+}
+
+function table(headers, rows) {
+  return '<table><tr>' + headers.map(h => '<th>' + escapeHTML(h) + '</th>').join('') + '</tr>' +
+    rows.map(row => '<tr>' + row.map(c => '<td>' + c + '</td>').join('') + '</tr>').join('') + '</table>';
+}
+
+document.getElementById('graph').addEventListener('submit', e => {
+  e.preventDefault();
+  const form = e.target, params = new URLSearchParams();
+  for (const element of form.elements) {
+    if (element.type === 'checkbox') params.set(element.name, element.checked);
+    else if (element.name === 'name') element.value.split(/\s+/).filter(n => n).forEach(n => params.append('name', n));
+    else if (element.name && element.value) params.set(element.name, element.value);
+  }
+  show(() => showGraph('/api/graph', params));
+});
+
+document.getElementById('who-can').addEventListener('submit', e => {
+  e.preventDefault();
+  const params = new URLSearchParams(new FormData(e.target));
+  if (e.submitter && e.submitter.name === 'render') {
+    show(() => showGraph('/api/who-can', params));
+    return;
+  }
+  show(async () => {
+    const entries = JSON.parse(await get('/api/who-can?' + params));
+    result.innerHTML = entries.length === 0 ? 'Nobody.' : table(['Subject', 'Binding', 'Role', 'Scope'],
+      entries.map(e => [e.subject, e.binding, e.role, e.scope].map(escapeHTML)));
+  });
+});
+
+document.getElementById('permissions').addEventListener('submit', e => {
+  e.preventDefault();
+  const [kind, name] = e.target.subject.value.split(/ (.*)/);
+  const parts = name.split('/'), params = new URLSearchParams({kind: kind, name: parts.pop()});
+  if (parts.length > 0) params.set('namespace', parts[0]);
+  show(async () => {
+    const permissions = JSON.parse(await get('/api/permissions?' + params));
+    const rules = grant => grant.rules.map(r => escapeHTML(r.verbs.join(',') + ' ' +
+      (r.nonResourceURLs || (r.resources || []).map(res => (r.apiGroups && r.apiGroups[0] ? r.apiGroups[0] + '/' : '') + res)).join(',') +
+      (r.resourceNames ? ' "' + r.resourceNames.join(',') + '"' : ''))).join('<br>');
+    result.innerHTML = '<h2>' + escapeHTML(permissions.subject) + '</h2>' +
+      (permissions.grants.length === 0 ? 'No permissions.' : table(['Binding', 'Role', 'Scope', 'Via group', 'Rules'],
+        permissions.grants.map(g => [g.binding, g.role, g.scope, g.via || ''].map(escapeHTML).concat([rules(g)]))));
+  });
+});
+
+get('/api/subjects').then(text => {
+  const select = document.querySelector('#permissions select');
+  for (const subject of JSON.parse(text)) select.add(new Option(subject));
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// UnusedReport lists RBAC resources that can most likely be cleaned up
+type UnusedReport struct {
+	ServiceAccounts         []UnusedServiceAccount `json:"serviceAccounts"`
+	Roles                   []string               `json:"roles"`
+	ClusterRoles            []string               `json:"clusterRoles"`
+	BindingsWithoutSubjects []string               `json:"bindingsWithoutSubjects"`
+}
+
+type UnusedServiceAccount struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Reasons   []string `json:"reasons"`
+}
+
+const (
+	reasonNoBindings  = "not referenced by any binding"
+	reasonNoWorkloads = "not used by any workload"
+)
+
+// findUnused collects ServiceAccounts without bindings (or without workloads, if workloads were part of the input),
+// (Cluster)Roles that aren't referenced by any binding and bindings that don't have any subjects
+func (r *Rback) findUnused() UnusedReport {
+	report := UnusedReport{
+		ServiceAccounts:         []UnusedServiceAccount{},
+		Roles:                   []string{},
+		ClusterRoles:            []string{},
+		BindingsWithoutSubjects: []string{},
+	}
+
+	boundSAs := map[NamespacedName]bool{}
+	referencedRoles := map[NamespacedName]bool{}
+	for ns, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			referencedRoles[binding.role] = true
+			for _, subject := range binding.subjects {
+				if subject.kind == "ServiceAccount" {
+					boundSAs[subject.NamespacedName] = true
+				}
+			}
+			if len(binding.subjects) == 0 && binding.ignoredSubjects == 0 && r.namespaceSelected(ns) && r.labelsSelected(binding.labels) {
+				report.BindingsWithoutSubjects = append(report.BindingsWithoutSubjects, qualifiedName(ns, binding.name))
+			}
+		}
+	}
+
+	usedSAs := map[NamespacedName]bool{}
+	for ns, workloads := range r.permissions.Workloads {
+		for _, workload := range workloads {
+			usedSAs[NamespacedName{ns, workload.serviceAccountName}] = true
+		}
+	}
+	hasWorkloads := len(r.permissions.Workloads) > 0
+
+	for ns, sas := range r.permissions.ServiceAccounts {
+		if !r.namespaceSelected(ns) {
+			continue
+		}
+		for name := range sas {
+			if name == "default" {
+				continue // created by Kubernetes in every namespace, so there's no point in reporting it
+			}
+			if !r.labelsSelected(r.serviceAccountLabels(ns, name)) {
+				continue
+			}
+			sa := NamespacedName{ns, name}
+			reasons := []string{}
+			if !boundSAs[sa] && !r.boundViaServiceAccountGroup(ns) {
+				reasons = append(reasons, reasonNoBindings)
+			}
+			if hasWorkloads && !usedSAs[sa] {
+				reasons = append(reasons, reasonNoWorkloads)
+			}
+			if len(reasons) > 0 {
+				report.ServiceAccounts = append(report.ServiceAccounts, UnusedServiceAccount{ns, name, reasons})
+			}
+		}
+	}
+
+	for ns, roles := range r.permissions.Roles {
+		if (ns == "" && !r.allNamespaces()) || (ns != "" && !r.namespaceSelected(ns)) {
+			continue
+		}
+		for name, role := range roles {
+			if referencedRoles[NamespacedName{ns, name}] || !r.labelsSelected(role.labels) {
+				continue
+			}
+			if ns == "" {
+				report.ClusterRoles = append(report.ClusterRoles, name)
+			} else {
+				report.Roles = append(report.Roles, qualifiedName(ns, name))
+			}
+		}
+	}
+
+	sort.Slice(report.ServiceAccounts, func(i, j int) bool {
+		a, b := report.ServiceAccounts[i], report.ServiceAccounts[j]
+		return qualifiedName(a.Namespace, a.Name) < qualifiedName(b.Namespace, b.Name)
+	})
+	sort.Strings(report.Roles)
+	sort.Strings(report.ClusterRoles)
+	sort.Strings(report.BindingsWithoutSubjects)
+	return report
+}
+
+// boundViaServiceAccountGroup returns true if a binding grants access to all ServiceAccounts (in the given namespace)
+func (r *Rback) boundViaServiceAccountGroup(ns string) bool {
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			for _, subject := range binding.subjects {
+				if subject.kind == "Group" && (subject.name == "system:serviceaccounts" || subject.name == "system:serviceaccounts:"+ns) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (r *Rback) printUnused(w io.Writer) error {
+	report := r.findUnused()
+
+	switch r.config.outputFormat {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "", "text":
+		sas := []string{}
+		for _, sa := range report.ServiceAccounts {
+			sas = append(sas, fmt.Sprintf("%s (%s)", qualifiedName(sa.Namespace, sa.Name), strings.Join(sa.Reasons, ", ")))
+		}
+		printSection(w, "Unused ServiceAccounts", sas)
+		printSection(w, "Unused Roles", report.Roles)
+		printSection(w, "Unused ClusterRoles", report.ClusterRoles)
+		printSection(w, "Bindings without subjects", report.BindingsWithoutSubjects)
+		return nil
+	default:
+		return fmt.Errorf("Unsupported output format %q (supported: text, json)", r.config.outputFormat)
+	}
+}
+
+func printSection(w io.Writer, title string, lines []string) {
+	fmt.Fprintf(w, "%s:\n", title)
+	if len(lines) == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+	for _, line := range lines {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+// qualifiedName returns "namespace/name" for namespaced resources and just "name" for cluster-scoped ones
+func qualifiedName(ns, name string) string {
+	if ns == "" {
+		return name
+	}
+	return ns + "/" + name
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const watchInterval = time.Second
+
+// watch renders the output file whenever the input files change and prints a summary of the changes; errors
+// (e.g. while a manifest is being edited) are reported without stopping to watch
+func watch(config Config) {
+	var previous map[string]string
+	state := ""
+	for {
+		if current := inputState(config.inputFile); current != state {
+			state = current
+			objects, err := render(config)
+			now := time.Now().Format("15:04:05")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s %v\n", now, err)
+			} else if previous == nil {
+				fmt.Fprintf(os.Stderr, "%s rendered %s from %d objects\n", now, config.outputFile, len(objects))
+			} else {
+				fmt.Fprintf(os.Stderr, "%s rendered %s: %s\n", now, config.outputFile, changeSummary(previous, objects))
+			}
+			if err == nil {
+				previous = objects
+			}
+		}
+		time.Sleep(watchInterval)
+	}
+}
+
+// inputState returns a fingerprint of the input files (their names, sizes and modification times)
+func inputState(path string) string {
+	files, err := inputFiles(path)
+	if err != nil {
+		return err.Error()
+	}
+	state := []string{}
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			state = append(state, fmt.Sprintf("%s:%d:%d", file, info.Size(), info.ModTime().UnixNano()))
+		}
+	}
+	return strings.Join(state, "\n")
+}
+
+// render parses the input, writes the output of the command to the output file and returns the parsed objects
+func render(config Config) (objects map[string]string, err error) {
+	defer func() {
+		// the parser expects valid Kubernetes objects and panics on malformed ones
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("Can't parse RBAC resources from %s: %v", config.inputFile, recovered)
+		}
+	}()
+
+	rback := Rback{config: config}
+	reader, err := openInput(config.inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read %s: %v", config.inputFile, err)
+	}
+	defer reader.Close()
+	if err := rback.parseRBAC(reader); err != nil {
+		return nil, fmt.Errorf("Can't parse RBAC resources from %s: %v", config.inputFile, err)
+	}
+
+	// write to a temporary file first, so that viewers never see a partially written file
+	temp, err := ioutil.TempFile(filepath.Dir(config.outputFile), ".rback-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(temp.Name())
+	runErr := rback.run(temp)
+	if err := temp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(temp.Name(), config.outputFile); err != nil {
+		return nil, err
+	}
+	if runErr != nil && config.command != commandCheck { // policy violations are part of the output
+		return nil, runErr
+	}
+	return rback.objects(), nil
+}
+
+// objects returns a description of all parsed objects by kind and name, used to summarize changes
+func (r *Rback) objects() map[string]string {
+	objects := map[string]string{}
+	for ns, serviceAccounts := range r.permissions.ServiceAccounts {
+		for name, sa := range serviceAccounts {
+			objects["ServiceAccount "+qualifiedName(ns, name)] = sa
+		}
+	}
+	for ns, roles := range r.permissions.Roles {
+		for name, role := range roles {
+			objects[iff(ns == "", "ClusterRole ", "Role ")+qualifiedName(ns, name)] = fmt.Sprint(role)
+		}
+	}
+	for ns, bindings := range r.permissions.RoleBindings {
+		for name, binding := range bindings {
+			objects[iff(ns == "", "ClusterRoleBinding ", "RoleBinding ")+qualifiedName(ns, name)] = fmt.Sprint(binding)
+		}
+	}
+	for ns, workloads := range r.permissions.Workloads {
+		for _, workload := range workloads {
+			// the pointers are dereferenced, since their addresses differ between renderings
+			description := fmt.Sprint(workload.serviceAccountName, workload.ObjectMeta)
+			if workload.automountServiceAccountToken != nil {
+				description += fmt.Sprint(*workload.automountServiceAccountToken)
+			}
+			if workload.controller != nil {
+				description += fmt.Sprint(*workload.controller)
+			}
+			objects[workload.kind+" "+qualifiedName(ns, workload.name)] = description
+		}
+	}
+	for name, namespace := range r.permissions.Namespaces {
+		objects["Namespace "+name] = fmt.Sprint(namespace)
+	}
+	for ns, secrets := range r.permissions.Secrets {
+		for name, secret := range secrets {
+			objects["Secret "+qualifiedName(ns, name)] = fmt.Sprint(secret)
+		}
+	}
+	return objects
+}
+
+// changeSummary describes the objects added, removed and changed between the two renderings
+func changeSummary(previous, current map[string]string) string {
+	added, removed, changed := []string{}, []string{}, []string{}
+	for object, description := range current {
+		if previousDescription, found := previous[object]; !found {
+			added = append(added, object)
+		} else if previousDescription != description {
+			changed = append(changed, object)
+		}
+	}
+	for object := range previous {
+		if _, found := current[object]; !found {
+			removed = append(removed, object)
+		}
+	}
+
+	summary := []string{}
+	for _, change := range []struct {
+		prefix  string
+		objects []string
+	}{{"+", added}, {"-", removed}, {"~", changed}} {
+		sort.Strings(change.objects)
+		for _, object := range change.objects {
+			summary = append(summary, change.prefix+object)
+		}
+	}
+	if len(summary) == 0 {
+		return "no changes to RBAC resources"
+	}
+	return strings.Join(summary, ", ")
+}